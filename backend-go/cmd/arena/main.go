@@ -0,0 +1,273 @@
+// Command arena plays two registered bots against each other and reports
+// how the first did against the second, e.g.
+//
+//      go run ./cmd/arena -a hard -b mcts -games 100 -openings 4
+//
+// The bots alternate who moves first. With -openings, each pair of games
+// starts from the same random opening with the colors swapped.
+package main
+
+import (
+        "context"
+        "encoding/json"
+        "flag"
+        "fmt"
+        "fourinrow/internal/bot"
+        "fourinrow/internal/game"
+        "log"
+        "math"
+        "math/rand"
+        "os"
+        "time"
+)
+
+type sideStats struct {
+        Name        string  `json:"name"`
+        Moves       int     `json:"moves"`
+        AvgMoveTime float64 `json:"avgMoveTimeMs"`
+        Forfeits    int     `json:"forfeits"`
+
+        thinking time.Duration
+}
+
+// report is the result of a match from the point of view of bot A. The Elo
+// fields are nil when A won or lost every game.
+type report struct {
+        Variant  string    `json:"variant"`
+        Games    int       `json:"games"`
+        Openings int       `json:"openingPlies"`
+        Wins     int       `json:"wins"`
+        Draws    int       `json:"draws"`
+        Losses   int       `json:"losses"`
+        Score    float64   `json:"score"`
+        EloDiff  *float64  `json:"eloDiff"`
+        EloLow   *float64  `json:"eloLow"`
+        EloHigh  *float64  `json:"eloHigh"`
+        A        sideStats `json:"a"`
+        B        sideStats `json:"b"`
+}
+
+func main() {
+        nameA := flag.String("a", "hard", "first bot")
+        nameB := flag.String("b", "medium", "second bot")
+        games := flag.Int("games", 20, "number of games to play")
+        variant := flag.String("variant", "", "variant to play (default standard)")
+        openings := flag.Int("openings", 0, "random plies to play before the bots take over")
+        moveTime := flag.Duration("movetime", 5*time.Second, "deadline for each move")
+        seed := flag.Int64("seed", time.Now().UnixNano(), "seed for the random openings")
+        external := flag.String("external", "", "JSON file of external bots to register")
+        jsonOut := flag.String("json", "", "also write the report as JSON to this file")
+        flag.Parse()
+
+        if *external != "" {
+                externalBots, err := bot.LoadExternalBots(*external)
+                if err != nil {
+                        log.Fatalf("Failed to load external bots: %v", err)
+                }
+                for _, externalBot := range externalBots {
+                        bot.Bots.Register(externalBot)
+                }
+        }
+
+        rules, err := game.ParseVariant(*variant)
+        if err != nil {
+                log.Fatal(err)
+        }
+        // The last cell can never be part of an opening: filling it ends
+        // the game.
+        if *openings < 0 || *openings >= rules.Rows*rules.Cols {
+                log.Fatalf("-openings must be between 0 and %d on a %dx%d board", rules.Rows*rules.Cols-1, rules.Cols, rules.Rows)
+        }
+        a, err := bot.ParseBot(*nameA)
+        if err != nil {
+                log.Fatal(err)
+        }
+        b, err := bot.ParseBot(*nameB)
+        if err != nil {
+                log.Fatal(err)
+        }
+
+        r := rand.New(rand.NewSource(*seed))
+        result := report{
+                Variant:  *variant,
+                Games:    *games,
+                Openings: *openings,
+                A:        sideStats{Name: a.Name()},
+                B:        sideStats{Name: b.Name()},
+        }
+        if result.Variant == "" {
+                result.Variant = "standard"
+        }
+
+        var opening []int
+        for i := 0; i < *games; i++ {
+                if i%2 == 0 {
+                        opening, err = randomOpening(rules, *openings, r)
+                        if err != nil {
+                                log.Fatal(err)
+                        }
+                }
+
+                first, second := a, b
+                firstStats, secondStats := &result.A, &result.B
+                if i%2 == 1 {
+                        first, second = b, a
+                        firstStats, secondStats = &result.B, &result.A
+                }
+
+                winner := playGame(rules, opening, first, second, firstStats, secondStats, *moveTime)
+                aWon := (winner == game.Player1) == (i%2 == 0)
+                switch {
+                case winner == game.Empty:
+                        result.Draws++
+                        fmt.Printf("Game %d: draw\n", i+1)
+                case aWon:
+                        result.Wins++
+                        fmt.Printf("Game %d: %s wins\n", i+1, a.Name())
+                default:
+                        result.Losses++
+                        fmt.Printf("Game %d: %s wins\n", i+1, b.Name())
+                }
+        }
+
+        result.summarize()
+        result.print()
+
+        if *jsonOut != "" {
+                data, err := json.MarshalIndent(result, "", "  ")
+                if err != nil {
+                        log.Fatalf("Failed to encode report: %v", err)
+                }
+                if err := os.WriteFile(*jsonOut, append(data, '\n'), 0o644); err != nil {
+                        log.Fatalf("Failed to write report: %v", err)
+                }
+        }
+}
+
+// maxOpeningAttempts is how many random games randomOpening plays looking
+// for one that lasts long enough. Long openings mostly end in a win first.
+const maxOpeningAttempts = 10000
+
+// randomOpening picks plies random drops that do not end the game.
+func randomOpening(rules game.Rules, plies int, r *rand.Rand) ([]int, error) {
+        for attempt := 0; attempt < maxOpeningAttempts; attempt++ {
+                board := game.NewBoard(rules)
+                player := game.Player1
+                opening := []int{}
+                for len(opening) < plies {
+                        columns := game.GetValidColumns(&board)
+                        if len(columns) == 0 {
+                                break
+                        }
+                        col := columns[r.Intn(len(columns))]
+                        game.MakeMove(&board, col, player)
+                        if winner, isDraw := game.CheckWinner(&board, rules); winner != game.Empty || isDraw {
+                                break
+                        }
+                        opening = append(opening, col)
+                        player = player.Opponent()
+                }
+                if len(opening) == plies {
+                        return opening, nil
+                }
+        }
+        return nil, fmt.Errorf("no %d-ply opening without a result found in %d tries, use fewer -openings", plies, maxOpeningAttempts)
+}
+
+// playGame plays first as Player1 against second from the given opening
+// and returns the winner, or Empty for a draw. A bot that makes an illegal
+// move loses.
+func playGame(rules game.Rules, opening []int, first, second bot.Strategy, firstStats, secondStats *sideStats, moveTime time.Duration) game.Player {
+        gameState := &game.GameState{Rules: rules, Board: game.NewBoard(rules), CurrentTurn: game.Player1}
+        for _, col := range opening {
+                move, _ := game.MakeMove(&gameState.Board, col, gameState.CurrentTurn)
+                gameState.RecordMove(move, "opening")
+                gameState.CurrentTurn = gameState.CurrentTurn.Opponent()
+        }
+
+        for {
+                player := gameState.CurrentTurn
+                strategy, stats := first, firstStats
+                if player == game.Player2 {
+                        strategy, stats = second, secondStats
+                }
+
+                ctx, cancel := context.WithTimeout(context.Background(), moveTime)
+                start := time.Now()
+                kind, column := strategy.SelectMove(ctx, &gameState.Board, rules, player)
+                stats.thinking += time.Since(start)
+                stats.Moves++
+                cancel()
+
+                move, err := game.ApplyMove(&gameState.Board, rules, kind, column, player)
+                if err != nil {
+                        log.Printf("%s made an illegal move and forfeits: %v", strategy.Name(), err)
+                        stats.Forfeits++
+                        return player.Opponent()
+                }
+                gameState.RecordMove(move, strategy.Name())
+
+                if winner, isDraw, _ := gameState.Outcome(player); winner != game.Empty || isDraw {
+                        return winner
+                }
+                gameState.CurrentTurn = player.Opponent()
+        }
+}
+
+// summarize works out A's score and the Elo difference it implies, with a
+// 95% confidence interval from the spread of the game results.
+func (r *report) summarize() {
+        for _, stats := range []*sideStats{&r.A, &r.B} {
+                if stats.Moves > 0 {
+                        stats.AvgMoveTime = float64(stats.thinking.Microseconds()) / float64(stats.Moves) / 1000
+                }
+        }
+
+        n := float64(r.Games)
+        if n == 0 {
+                return
+        }
+        score := (float64(r.Wins) + float64(r.Draws)/2) / n
+        r.Score = score
+
+        variance := (float64(r.Wins)*math.Pow(1-score, 2) + float64(r.Draws)*math.Pow(0.5-score, 2) + float64(r.Losses)*math.Pow(score, 2)) / n
+        margin := 1.96 * math.Sqrt(variance/n)
+
+        r.EloDiff = eloDiff(score)
+        r.EloLow = eloDiff(score - margin)
+        r.EloHigh = eloDiff(score + margin)
+}
+
+// eloDiff is the rating difference at which the expected score is score,
+// or nil when score is 0 or 1.
+func eloDiff(score float64) *float64 {
+        if score <= 0 || score >= 1 {
+                return nil
+        }
+        diff := 400 * math.Log10(score/(1-score))
+        return &diff
+}
+
+func (r *report) print() {
+        fmt.Printf("\n%s vs %s, %d games on %s", r.A.Name, r.B.Name, r.Games, r.Variant)
+        if r.Openings > 0 {
+                fmt.Printf(" with %d-ply random openings", r.Openings)
+        }
+        fmt.Println()
+        fmt.Printf("  +%d =%d -%d, score %.1f%%\n", r.Wins, r.Draws, r.Losses, 100*r.Score)
+        fmt.Printf("  Elo difference: %s (95%% CI %s to %s)\n", formatElo(r.EloDiff), formatElo(r.EloLow), formatElo(r.EloHigh))
+        for _, stats := range []sideStats{r.A, r.B} {
+                fmt.Printf("  %s: %d moves, %.1fms per move", stats.Name, stats.Moves, stats.AvgMoveTime)
+                if stats.Forfeits > 0 {
+                        fmt.Printf(", %d forfeits", stats.Forfeits)
+                }
+                fmt.Println()
+        }
+}
+
+func formatElo(diff *float64) string {
+        if diff == nil {
+                return "n/a"
+        }
+        return fmt.Sprintf("%+.0f", *diff)
+}
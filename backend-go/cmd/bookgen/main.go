@@ -0,0 +1,54 @@
+// Command bookgen solves the early positions of the standard board and
+// writes them as the opening book embedded by the bot package.
+//
+//      go run ./cmd/bookgen -depth 4 -out internal/bot/book.bin
+//
+// Each extra ply of depth multiplies the time taken several times over.
+package main
+
+import (
+        "context"
+        "flag"
+        "fourinrow/internal/bot"
+        "log"
+        "os"
+        "time"
+)
+
+func main() {
+        depth := flag.Int("depth", 4, "deepest ply to include in the book")
+        out := flag.String("out", "internal/bot/book.bin", "file to write the book to")
+        timeout := flag.Duration("timeout", 0, "give up after this long (0 for no limit)")
+        flag.Parse()
+
+        ctx := context.Background()
+        if *timeout > 0 {
+                var cancel context.CancelFunc
+                ctx, cancel = context.WithTimeout(ctx, *timeout)
+                defer cancel()
+        }
+
+        start := time.Now()
+        solver := bot.NewSolver(nil)
+        book, err := solver.GenerateOpeningBook(ctx, *depth, func(depth, done, total int) {
+                if done == total || done%50 == 0 {
+                        log.Printf("Depth %d: %d/%d positions solved (%s)", depth, done, total, time.Since(start).Round(time.Second))
+                }
+        })
+        if err != nil {
+                log.Fatalf("Failed to generate opening book: %v", err)
+        }
+
+        f, err := os.Create(*out)
+        if err != nil {
+                log.Fatalf("Failed to create %s: %v", *out, err)
+        }
+        if _, err := book.WriteTo(f); err != nil {
+                log.Fatalf("Failed to write opening book: %v", err)
+        }
+        if err := f.Close(); err != nil {
+                log.Fatalf("Failed to write opening book: %v", err)
+        }
+
+        log.Printf("✅ Wrote %d positions up to depth %d to %s in %s", book.Len(), *depth, *out, time.Since(start).Round(time.Second))
+}
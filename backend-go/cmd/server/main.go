@@ -2,6 +2,9 @@ package main
 
 import (
         "encoding/json"
+        "errors"
+        "fourinrow/internal/bot"
+        "fourinrow/internal/chat"
         "fourinrow/internal/database"
         "fourinrow/internal/game"
         "fourinrow/internal/kafka"
@@ -12,6 +15,9 @@ import (
         "os"
         "os/signal"
         "path/filepath"
+        "runtime"
+        "strconv"
+        "strings"
         "syscall"
         "time"
 
@@ -49,9 +55,70 @@ func main() {
         }
         defer kafkaProducer.Close()
 
+        if playouts, err := strconv.Atoi(os.Getenv("MCTS_PLAYOUTS")); err == nil {
+                bot.Bots.Register(bot.NewMCTS(playouts))
+        }
+
+        if path := os.Getenv("EXTERNAL_BOTS"); path != "" {
+                externalBots, err := bot.LoadExternalBots(path)
+                if err != nil {
+                        log.Fatalf("Failed to load external bots: %v", err)
+                }
+                for _, externalBot := range externalBots {
+                        bot.Bots.Register(externalBot)
+                        log.Printf("Registered external bot %s", externalBot.Name())
+                }
+        }
+
         matchmaker := matchmaking.NewMatchmaker(10*time.Second, 30*time.Second)
+        matchmaker.SetRatingLoader(db.GetRating)
+        if window := os.Getenv("MATCH_RATING_WINDOW"); window != "" {
+                ratingWindow, err := matchmaking.ParseRatingWindow(window)
+                if err != nil {
+                        log.Fatalf("Invalid MATCH_RATING_WINDOW: %v", err)
+                }
+                matchmaker.SetRatingWindow(ratingWindow)
+        }
         hub := websocket.NewHub(matchmaker)
 
+        if timeControl := os.Getenv("TIME_CONTROL"); timeControl != "" {
+                clock, err := game.ParseTimeControl(timeControl)
+                if err != nil {
+                        log.Fatalf("Invalid TIME_CONTROL: %v", err)
+                }
+                hub.SetDefaultTimeControl(clock)
+        }
+
+        if keys := os.Getenv("BOT_API_KEYS"); keys != "" {
+                botAPIKeys := make(map[string]string)
+                for _, entry := range strings.Split(keys, ",") {
+                        name, key, ok := strings.Cut(strings.TrimSpace(entry), "=")
+                        if !ok || name == "" || key == "" {
+                                log.Fatalf("Invalid BOT_API_KEYS entry %q, expected name=key", entry)
+                        }
+                        botAPIKeys[name] = key
+                }
+                hub.SetBotAPIKeys(botAPIKeys)
+        }
+
+        if words := os.Getenv("CHAT_BLOCKED_WORDS"); words != "" {
+                hub.SetChatFilter(chat.NewBlockList(strings.Split(words, ",")))
+        }
+        hub.SetStoreChat(os.Getenv("CHAT_TRANSCRIPTS") == "true")
+
+        if ratings := os.Getenv("BOT_RATINGS"); ratings != "" {
+                botRatings := make(map[string]float64)
+                for _, entry := range strings.Split(ratings, ",") {
+                        name, value, ok := strings.Cut(strings.TrimSpace(entry), "=")
+                        botRating, err := strconv.ParseFloat(value, 64)
+                        if !ok || name == "" || err != nil {
+                                log.Fatalf("Invalid BOT_RATINGS entry %q, expected name=rating", entry)
+                        }
+                        botRatings[name] = botRating
+                }
+                matchmaker.SetBotRatings(botRatings)
+        }
+
         hub.SetGameEventCallback(func(eventType string, data interface{}) {
                 if err := kafkaProducer.ProduceEvent(eventType, data); err != nil {
                         log.Printf("Failed to produce Kafka event: %v", err)
@@ -66,6 +133,16 @@ func main() {
                 }
         })
 
+        // Games in progress are served as snapshots, since their moves
+        // carry on while the response is written.
+        loadGame := func(gameID string) (*game.GameState, error) {
+                if gameState, exists := matchmaker.SnapshotGame(gameID); exists {
+                        return gameState, nil
+                }
+                return db.GetGame(gameID)
+        }
+        hub.SetGameLoader(loadGame)
+
         go hub.Run()
 
         router := mux.NewRouter()
@@ -87,7 +164,15 @@ func main() {
         }).Methods("GET")
 
         router.HandleFunc("/api/leaderboard", func(w http.ResponseWriter, r *http.Request) {
-                stats, err := db.GetLeaderboard(10)
+                sortBy := r.URL.Query().Get("sort")
+                if sortBy == "" {
+                        sortBy = database.SortByRating
+                }
+                if sortBy != database.SortByRating && sortBy != database.SortByWins {
+                        http.Error(w, "sort must be rating or wins", http.StatusBadRequest)
+                        return
+                }
+                stats, err := db.GetLeaderboard(10, sortBy)
                 if err != nil {
                         http.Error(w, err.Error(), http.StatusInternalServerError)
                         return
@@ -98,6 +183,214 @@ func main() {
                 }
         }).Methods("GET")
 
+        router.HandleFunc("/api/players/{username}/ratings", func(w http.ResponseWriter, r *http.Request) {
+                history, err := db.GetRatingHistory(mux.Vars(r)["username"])
+                if err != nil {
+                        http.Error(w, err.Error(), http.StatusInternalServerError)
+                        return
+                }
+                w.Header().Set("Content-Type", "application/json")
+                if err := json.NewEncoder(w).Encode(history); err != nil {
+                        log.Printf("Failed to encode rating history response: %v", err)
+                }
+        }).Methods("GET")
+
+        router.HandleFunc("/api/queue", func(w http.ResponseWriter, r *http.Request) {
+                w.Header().Set("Content-Type", "application/json")
+                if err := json.NewEncoder(w).Encode(matchmaker.QueueStats()); err != nil {
+                        log.Printf("Failed to encode queue response: %v", err)
+                }
+        }).Methods("GET")
+
+        router.HandleFunc("/api/bots", func(w http.ResponseWriter, r *http.Request) {
+                bots := []map[string]string{}
+                for _, strategy := range bot.Bots.List() {
+                        bots = append(bots, map[string]string{
+                                "name":        strategy.Name(),
+                                "displayName": bot.DisplayName(strategy),
+                                "description": strategy.Description(),
+                        })
+                }
+                w.Header().Set("Content-Type", "application/json")
+                if err := json.NewEncoder(w).Encode(bots); err != nil {
+                        log.Printf("Failed to encode bots response: %v", err)
+                }
+        }).Methods("GET")
+
+        router.HandleFunc("/api/games/live", func(w http.ResponseWriter, r *http.Request) {
+                w.Header().Set("Content-Type", "application/json")
+                if err := json.NewEncoder(w).Encode(hub.LiveGames()); err != nil {
+                        log.Printf("Failed to encode live games response: %v", err)
+                }
+        }).Methods("GET")
+
+        router.HandleFunc("/api/games/{id}", func(w http.ResponseWriter, r *http.Request) {
+                gameState, err := loadGame(mux.Vars(r)["id"])
+                if errors.Is(err, database.ErrGameNotFound) {
+                        http.Error(w, err.Error(), http.StatusNotFound)
+                        return
+                }
+                if err != nil {
+                        http.Error(w, err.Error(), http.StatusInternalServerError)
+                        return
+                }
+                // Chat transcripts are only published once the game is over.
+                response := struct {
+                        *game.GameState
+                        Chat []game.ChatLine `json:"chat,omitempty"`
+                }{GameState: gameState}
+                if gameState.IsFinished {
+                        response.Chat = gameState.Chat
+                }
+                w.Header().Set("Content-Type", "application/json")
+                if err := json.NewEncoder(w).Encode(response); err != nil {
+                        log.Printf("Failed to encode game response: %v", err)
+                }
+        }).Methods("GET")
+
+        router.HandleFunc("/api/games/{id}/positions", func(w http.ResponseWriter, r *http.Request) {
+                gameState, err := loadGame(mux.Vars(r)["id"])
+                if errors.Is(err, database.ErrGameNotFound) {
+                        http.Error(w, err.Error(), http.StatusNotFound)
+                        return
+                }
+                if err != nil {
+                        http.Error(w, err.Error(), http.StatusInternalServerError)
+                        return
+                }
+
+                ply := len(gameState.Moves)
+                if plyParam := r.URL.Query().Get("ply"); plyParam != "" {
+                        ply, err = strconv.Atoi(plyParam)
+                        if err != nil {
+                                http.Error(w, "invalid ply", http.StatusBadRequest)
+                                return
+                        }
+                }
+
+                board, err := game.ReplayMoves(gameState.Rules, gameState.Moves, ply)
+                if err != nil {
+                        http.Error(w, err.Error(), http.StatusBadRequest)
+                        return
+                }
+
+                nextTurn := game.Player1
+                if ply%2 == 1 {
+                        nextTurn = game.Player2
+                }
+                response := map[string]interface{}{
+                        "gameId":      gameState.ID,
+                        "ply":         ply,
+                        "totalMoves":  len(gameState.Moves),
+                        "board":       board,
+                        "currentTurn": nextTurn,
+                }
+                if ply > 0 {
+                        response["lastMove"] = gameState.Moves[ply-1]
+                }
+
+                w.Header().Set("Content-Type", "application/json")
+                if err := json.NewEncoder(w).Encode(response); err != nil {
+                        log.Printf("Failed to encode position response: %v", err)
+                }
+        }).Methods("GET")
+
+        // Analysis takes up to the solver's whole budget on a CPU, so only so
+        // many run at once; the rest are turned away rather than queued.
+        analyzeSlots := make(chan struct{}, runtime.NumCPU())
+        router.HandleFunc("/api/analyze", func(w http.ResponseWriter, r *http.Request) {
+                var request struct {
+                        Board   game.Board  `json:"board"`
+                        Variant string      `json:"variant"`
+                        Player  game.Player `json:"player"`
+                        GameID  string      `json:"gameId"`
+                        Ply     *int        `json:"ply"`
+                }
+                if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+                        http.Error(w, "invalid request body", http.StatusBadRequest)
+                        return
+                }
+
+                var (
+                        board  game.Board
+                        rules  game.Rules
+                        toMove game.Player
+                )
+                if request.GameID != "" {
+                        gameState, err := loadGame(request.GameID)
+                        if errors.Is(err, database.ErrGameNotFound) {
+                                http.Error(w, err.Error(), http.StatusNotFound)
+                                return
+                        }
+                        if err != nil {
+                                http.Error(w, err.Error(), http.StatusInternalServerError)
+                                return
+                        }
+                        if !gameState.HintsAllowed() && !gameState.IsFinished {
+                                http.Error(w, "analysis is disabled while a rated game is in progress", http.StatusForbidden)
+                                return
+                        }
+
+                        ply := len(gameState.Moves)
+                        if request.Ply != nil {
+                                ply = *request.Ply
+                        }
+                        board, err = game.ReplayMoves(gameState.Rules, gameState.Moves, ply)
+                        if err != nil {
+                                http.Error(w, err.Error(), http.StatusBadRequest)
+                                return
+                        }
+                        rules = gameState.Rules
+                        toMove = game.Player1
+                        if ply%2 == 1 {
+                                toMove = game.Player2
+                        }
+                } else {
+                        var err error
+                        rules, err = game.ParseVariant(request.Variant)
+                        if err != nil {
+                                http.Error(w, err.Error(), http.StatusBadRequest)
+                                return
+                        }
+                        if err := game.ValidateBoard(request.Board, rules); err != nil {
+                                http.Error(w, err.Error(), http.StatusBadRequest)
+                                return
+                        }
+                        board = request.Board
+                        toMove = request.Player
+                        if toMove == game.Empty {
+                                toMove, err = game.NextPlayer(&board)
+                                if err != nil {
+                                        http.Error(w, err.Error(), http.StatusBadRequest)
+                                        return
+                                }
+                        }
+                        if toMove != game.Player1 && toMove != game.Player2 {
+                                http.Error(w, "invalid player", http.StatusBadRequest)
+                                return
+                        }
+                }
+
+                select {
+                case analyzeSlots <- struct{}{}:
+                        defer func() { <-analyzeSlots }()
+                default:
+                        http.Error(w, "too many analyses in progress, try again shortly", http.StatusTooManyRequests)
+                        return
+                }
+
+                analysis, err := bot.AnalyzePosition(r.Context(), &board, rules, toMove)
+                if err != nil {
+                        http.Error(w, err.Error(), http.StatusBadRequest)
+                        return
+                }
+
+                w.Header().Set("Content-Type", "application/json")
+                if err := json.NewEncoder(w).Encode(analysis); err != nil {
+                        log.Printf("Failed to encode analysis response: %v", err)
+                }
+        }).Methods("POST")
+
         frontendPath := filepath.Join("..", "frontend", "dist")
         fs := http.FileServer(http.Dir(frontendPath))
         router.PathPrefix("/").Handler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
@@ -0,0 +1,64 @@
+// Command solve prints the solved value of a standard board position, given
+// as the sequence of columns played so far (1-7), e.g.
+//
+//      go run ./cmd/solve 4453
+package main
+
+import (
+        "context"
+        "flag"
+        "fmt"
+        "fourinrow/internal/bot"
+        "fourinrow/internal/game"
+        "log"
+        "strings"
+)
+
+func main() {
+        flag.Usage = func() {
+                fmt.Fprintln(flag.CommandLine.Output(), "usage: solve [moves]")
+                flag.PrintDefaults()
+        }
+        flag.Parse()
+
+        board := game.CreateBoard()
+        player := game.Player1
+        for i, ch := range strings.Join(flag.Args(), "") {
+                if ch < '1' || ch > '0'+game.Cols {
+                        log.Fatalf("Move %d: %q is not a column", i+1, ch)
+                }
+                if _, err := game.MakeMove(&board, int(ch-'1'), player); err != nil {
+                        log.Fatalf("Move %d: %v", i+1, err)
+                }
+                player = player.Opponent()
+        }
+
+        solver := bot.DefaultSolver()
+        ctx := context.Background()
+
+        value, err := solver.Evaluate(ctx, &board)
+        if err != nil {
+                log.Fatalf("Failed to solve position: %v", err)
+        }
+        scores, err := solver.Analyze(ctx, &board)
+        if err != nil {
+                log.Fatalf("Failed to analyze position: %v", err)
+        }
+        best, _, err := solver.BestMoves(ctx, &board)
+        if err != nil {
+                log.Fatalf("Failed to analyze position: %v", err)
+        }
+
+        fmt.Printf("Player %d to move: %s (score %d)\n", value.ToMove, value, value.Score)
+        for col, score := range scores {
+                if score == bot.InvalidScore {
+                        fmt.Printf("  column %d: full\n", col+1)
+                        continue
+                }
+                fmt.Printf("  column %d: %d\n", col+1, score)
+        }
+        for i := range best {
+                best[i]++
+        }
+        fmt.Printf("Best moves: %v\n", best)
+}
@@ -0,0 +1,164 @@
+package bot
+
+import (
+        "context"
+        "errors"
+        "fourinrow/internal/game"
+        "time"
+)
+
+// AnalysisTimeBudget bounds how long AnalyzePosition searches.
+const AnalysisTimeBudget = 2 * time.Second
+
+var ErrAnalysisUnavailable = errors.New("analysis is only available for drop games on boards that fit a bitboard")
+
+// Outcomes of a position for the player to move. OutcomeUnknown means the
+// search ran out of time before proving a result.
+const (
+        OutcomeWin     = "win"
+        OutcomeLoss    = "loss"
+        OutcomeDraw    = "draw"
+        OutcomeUnknown = "unknown"
+)
+
+// ColumnScore is the evaluation of dropping a disc into Column, from the
+// point of view of the player to move.
+type ColumnScore struct {
+        Column int `json:"column"`
+        Score  int `json:"score"`
+        // Winner is set when the search proved a forced win for either side
+        // after this move, and MovesToWin counts the winner's moves from the
+        // analyzed position, including the winning one.
+        Winner     game.Player `json:"winner,omitempty"`
+        MovesToWin int         `json:"movesToWin,omitempty"`
+}
+
+// Analysis is the evaluation of every legal column in a position. Scores
+// come from the solver when Solved is set, and otherwise from negamax
+// searching Depth plies; the two scales are not comparable.
+type Analysis struct {
+        ToMove     game.Player   `json:"toMove"`
+        Columns    []ColumnScore `json:"columns"`
+        BestColumn int           `json:"bestColumn"`
+        Outcome    string        `json:"outcome"`
+        ForcedWin  bool          `json:"forcedWin"`
+        ForcedLoss bool          `json:"forcedLoss"`
+        MovesToWin int           `json:"movesToWin,omitempty"`
+        Solved     bool          `json:"solved"`
+        Depth      int           `json:"depth,omitempty"`
+}
+
+// AnalyzePosition scores every column toMove could drop into, returning by
+// the earlier of ctx's deadline and AnalysisTimeBudget. Standard boards are
+// solved exactly when the solver finishes in two thirds of the budget;
+// otherwise the scores are those of the deepest negamax search that did.
+func AnalyzePosition(ctx context.Context, board *game.Board, rules game.Rules, toMove game.Player) (*Analysis, error) {
+        if rules.PopOut {
+                return nil, ErrAnalysisUnavailable
+        }
+        bb, err := game.BitboardFromBoard(*board, rules)
+        if err != nil {
+                return nil, ErrAnalysisUnavailable
+        }
+        if bb.HasWon(game.Player1) || bb.HasWon(game.Player2) {
+                return nil, errors.New("the game is already won")
+        }
+        if bb.IsFull() {
+                return nil, errors.New("no legal moves")
+        }
+
+        budget := AnalysisTimeBudget
+        if rules == game.DefaultRules() {
+                solveCtx, cancel := context.WithTimeout(ctx, budget*2/3)
+                analysis, err := solvedAnalysis(solveCtx, board, toMove)
+                cancel()
+                if err == nil {
+                        return analysis, nil
+                }
+                budget -= budget * 2 / 3
+        }
+
+        ctx, cancel := context.WithTimeout(ctx, budget)
+        defer cancel()
+
+        search := newSearcher(ctx, rules)
+        defer search.release()
+        scores, depth := search.scoreMoves(&bb, toMove, maxPly)
+        analysis := &Analysis{ToMove: toMove, Depth: depth}
+        for _, col := range centerOrder(bb.Cols()) {
+                if !bb.CanPlay(col) {
+                        continue
+                }
+                column := ColumnScore{Column: col, Score: scores[col]}
+                switch {
+                case scores[col] > winScore-maxPly:
+                        column.Winner = toMove
+                        column.MovesToWin = (winScore-scores[col])/2 + 1
+                case scores[col] < -winScore+maxPly:
+                        column.Winner = toMove.Opponent()
+                        column.MovesToWin = (winScore + scores[col] + 1) / 2
+                }
+                analysis.Columns = append(analysis.Columns, column)
+        }
+        analysis.summarize()
+        return analysis, nil
+}
+
+// solvedAnalysis is AnalyzePosition for the standard board using the
+// solver. The disc counts must agree with toMove.
+func solvedAnalysis(ctx context.Context, board *game.Board, toMove game.Player) (*Analysis, error) {
+        pos, player, err := positionFromBoard(board)
+        if err != nil {
+                return nil, err
+        }
+        if player != toMove {
+                return nil, errors.New("the disc counts do not match the player to move")
+        }
+
+        scores, err := DefaultSolver().Analyze(ctx, board)
+        if err != nil {
+                return nil, err
+        }
+
+        analysis := &Analysis{ToMove: toMove, Solved: true}
+        for _, col := range centerOrder(solverWidth) {
+                if scores[col] == InvalidScore {
+                        continue
+                }
+                value := scoreValue(scores[col], pos.moves, toMove)
+                analysis.Columns = append(analysis.Columns, ColumnScore{
+                        Column:     col,
+                        Score:      scores[col],
+                        Winner:     value.Winner,
+                        MovesToWin: value.MovesToWin,
+                })
+        }
+        analysis.summarize()
+        return analysis, nil
+}
+
+// summarize picks the best column, the first in center order on ties, and
+// derives the outcome from it. Draws are only known when solved.
+func (a *Analysis) summarize() {
+        best := a.Columns[0]
+        for _, column := range a.Columns[1:] {
+                if column.Score > best.Score {
+                        best = column
+                }
+        }
+        a.BestColumn = best.Column
+        a.MovesToWin = best.MovesToWin
+
+        switch {
+        case best.Winner == a.ToMove:
+                a.Outcome = OutcomeWin
+                a.ForcedWin = true
+        case best.Winner == a.ToMove.Opponent():
+                a.Outcome = OutcomeLoss
+                a.ForcedLoss = true
+        case a.Solved:
+                a.Outcome = OutcomeDraw
+        default:
+                a.Outcome = OutcomeUnknown
+        }
+}
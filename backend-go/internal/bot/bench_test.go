@@ -0,0 +1,60 @@
+package bot
+
+import (
+        "context"
+        "fourinrow/internal/game"
+        "testing"
+)
+
+func benchmarkBoard(b *testing.B) game.Board {
+        board := game.CreateBoard()
+        player := game.Player1
+        for _, col := range []int{3, 3, 2, 4, 4, 2, 5, 1, 1, 0, 6, 6, 0, 5, 2, 3} {
+                if _, err := game.MakeMove(&board, col, player); err != nil {
+                        b.Fatal(err)
+                }
+                player = player.Opponent()
+        }
+        return board
+}
+
+func BenchmarkFindWinningMove(b *testing.B) {
+        board := benchmarkBoard(b)
+        rules := game.DefaultRules()
+        b.ResetTimer()
+        for i := 0; i < b.N; i++ {
+                findWinningMove(&board, rules, game.Player1)
+        }
+}
+
+// BenchmarkFindWinningMoveScan measures the copy-per-candidate search
+// findWinningMove used before bitboards.
+func BenchmarkFindWinningMoveScan(b *testing.B) {
+        board := benchmarkBoard(b)
+        rules := game.DefaultRules()
+        b.ResetTimer()
+        for i := 0; i < b.N; i++ {
+                findWinningMoveScan(&board, rules, game.Player1)
+        }
+}
+
+func BenchmarkSelectBotMove(b *testing.B) {
+        board := benchmarkBoard(b)
+        rules := game.DefaultRules()
+        b.ResetTimer()
+        for i := 0; i < b.N; i++ {
+                SelectBotMove(&board, rules, game.Player1)
+        }
+}
+
+// BenchmarkSelectMediumMove reports the allocations of a negamax move,
+// which reuses its transposition table from one move to the next.
+func BenchmarkSelectMediumMove(b *testing.B) {
+        board := benchmarkBoard(b)
+        rules := game.DefaultRules()
+        b.ReportAllocs()
+        b.ResetTimer()
+        for i := 0; i < b.N; i++ {
+                SelectMove(context.Background(), Medium, &board, rules, game.Player1)
+        }
+}
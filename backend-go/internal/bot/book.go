@@ -0,0 +1,149 @@
+package bot
+
+import (
+        "bytes"
+        _ "embed"
+        "encoding/binary"
+        "errors"
+        "io"
+        "log"
+        "sort"
+        "sync"
+)
+
+// Opening book file format, all integers little-endian:
+//
+//      offset  size  field
+//      0       4     magic "C4OB"
+//      4       1     format version, currently 1
+//      5       1     board width (7)
+//      6       1     board height (6)
+//      7       1     deepest ply covered
+//      8       4     entry count n
+//      12      9n    entries sorted by key: uint64 key, int8 score
+//
+// The key of a position is current+mask as in position.key, taking the
+// smaller of the position and its mirror image, and the score is the solved
+// score for the player to move. Positions where the player to move can win
+// at once are left out.
+const (
+        bookMagic   = "C4OB"
+        bookVersion = 1
+)
+
+//go:embed book.bin
+var embeddedBook []byte
+
+// OpeningBook holds solved scores for the early positions of the standard
+// board. A nil book is empty.
+type OpeningBook struct {
+        maxDepth int
+        scores   map[uint64]int8
+}
+
+func NewOpeningBook(maxDepth int) *OpeningBook {
+        return &OpeningBook{maxDepth: maxDepth, scores: make(map[uint64]int8)}
+}
+
+var (
+        defaultBook     *OpeningBook
+        defaultBookOnce sync.Once
+)
+
+// DefaultOpeningBook returns the book embedded in the binary.
+func DefaultOpeningBook() *OpeningBook {
+        defaultBookOnce.Do(func() {
+                book, err := ReadOpeningBook(bytes.NewReader(embeddedBook))
+                if err != nil {
+                        log.Printf("Failed to load opening book: %v", err)
+                        book = NewOpeningBook(-1)
+                }
+                defaultBook = book
+        })
+        return defaultBook
+}
+
+// MaxDepth is the number of moves played in the deepest positions covered.
+func (b *OpeningBook) MaxDepth() int {
+        if b == nil {
+                return -1
+        }
+        return b.maxDepth
+}
+
+func (b *OpeningBook) Len() int {
+        if b == nil {
+                return 0
+        }
+        return len(b.scores)
+}
+
+func (b *OpeningBook) lookup(pos *position) (int, bool) {
+        if b == nil || pos.moves > b.maxDepth {
+                return 0, false
+        }
+        score, ok := b.scores[bookKey(pos)]
+        return int(score), ok
+}
+
+func (b *OpeningBook) add(pos *position, score int) {
+        b.scores[bookKey(pos)] = int8(score)
+}
+
+func bookKey(pos *position) uint64 {
+        return min(pos.key(), pos.mirrorKey())
+}
+
+func ReadOpeningBook(r io.Reader) (*OpeningBook, error) {
+        var header struct {
+                Magic    [4]byte
+                Version  uint8
+                Width    uint8
+                Height   uint8
+                MaxDepth uint8
+                Count    uint32
+        }
+        if err := binary.Read(r, binary.LittleEndian, &header); err != nil {
+                return nil, err
+        }
+        if string(header.Magic[:]) != bookMagic {
+                return nil, errors.New("not an opening book")
+        }
+        if header.Version != bookVersion {
+                return nil, errors.New("unsupported opening book version")
+        }
+        if header.Width != solverWidth || header.Height != solverHeight {
+                return nil, errors.New("opening book is for a different board size")
+        }
+
+        book := NewOpeningBook(int(header.MaxDepth))
+        for i := uint32(0); i < header.Count; i++ {
+                var entry struct {
+                        Key   uint64
+                        Score int8
+                }
+                if err := binary.Read(r, binary.LittleEndian, &entry); err != nil {
+                        return nil, err
+                }
+                book.scores[entry.Key] = entry.Score
+        }
+        return book, nil
+}
+
+func (b *OpeningBook) WriteTo(w io.Writer) (int64, error) {
+        keys := make([]uint64, 0, len(b.scores))
+        for key := range b.scores {
+                keys = append(keys, key)
+        }
+        sort.Slice(keys, func(i, j int) bool { return keys[i] < keys[j] })
+
+        var buf bytes.Buffer
+        buf.WriteString(bookMagic)
+        buf.Write([]byte{bookVersion, solverWidth, solverHeight, uint8(b.maxDepth)})
+        binary.Write(&buf, binary.LittleEndian, uint32(len(keys)))
+        for _, key := range keys {
+                binary.Write(&buf, binary.LittleEndian, key)
+                buf.WriteByte(byte(b.scores[key]))
+        }
+        return buf.WriteTo(w)
+}
@@ -0,0 +1,99 @@
+package bot
+
+import (
+        "bytes"
+        "context"
+        "fourinrow/internal/game"
+        "testing"
+)
+
+// firstMoveScores are the solved scores of each first move on the empty
+// board, for the first player.
+var firstMoveScores = [solverWidth]int{-2, -1, 0, 1, 0, -1, -2}
+
+func TestEmbeddedBook(t *testing.T) {
+        book := DefaultOpeningBook()
+        // The perfect bot plays second, and looks up the positions after
+        // each of its replies when choosing one: its first two moves need
+        // four plies.
+        if book.MaxDepth() < 4 || book.Len() == 0 {
+                t.Fatalf("embedded book covers %d plies with %d positions, want at least 4", book.MaxDepth(), book.Len())
+        }
+
+        for col, want := range firstMoveScores {
+                var pos position
+                pos.play(pos.columnMove(col))
+                score, ok := book.lookup(&pos)
+                if !ok {
+                        t.Errorf("book has no entry for a first move in column %d", col)
+                        continue
+                }
+                // The book scores the position for the second player.
+                if score != -want {
+                        t.Errorf("book scores a first move in column %d as %d, want %d", col, -score, want)
+                }
+        }
+
+        var buf bytes.Buffer
+        if _, err := book.WriteTo(&buf); err != nil {
+                t.Fatal(err)
+        }
+        if !bytes.Equal(buf.Bytes(), embeddedBook) {
+                t.Error("writing the embedded book back out changes it")
+        }
+}
+
+// TestBestMovesEmptyBoard checks that the perfect bot finds the opening
+// move from the book well within its share of the time budget.
+func TestBestMovesEmptyBoard(t *testing.T) {
+        ctx, cancel := context.WithTimeout(context.Background(), Levels[Perfect].TimeBudget*2/3)
+        defer cancel()
+
+        board := game.CreateBoard()
+        columns, score, err := DefaultSolver().BestMoves(ctx, &board)
+        if err != nil {
+                t.Fatalf("BestMoves on the empty board: %v", err)
+        }
+        if len(columns) != 1 || columns[0] != 3 || score != firstMoveScores[3] {
+                t.Errorf("BestMoves on the empty board = %v, %d, want [3], %d", columns, score, firstMoveScores[3])
+        }
+}
+
+// playColumns plays moves given as columns numbered from 1, as cmd/solve
+// takes them.
+func playColumns(t *testing.T, moves string) game.Board {
+        t.Helper()
+        board := game.CreateBoard()
+        player := game.Player1
+        for _, ch := range moves {
+                if _, err := game.MakeMove(&board, int(ch-'1'), player); err != nil {
+                        t.Fatalf("%s: %v", moves, err)
+                }
+                player = player.Opponent()
+        }
+        return board
+}
+
+// TestBestMovesBotSecondMove checks that the perfect bot's second move is
+// solved, not left to negamax, within the bot's real deadline. The exact
+// search alone takes far longer than that this early in the game.
+func TestBestMovesBotSecondMove(t *testing.T) {
+        for _, moves := range []string{"443", "412", "723", "345", "111"} {
+                board := playColumns(t, moves)
+                ctx, cancel := context.WithTimeout(context.Background(), Levels[Perfect].TimeBudget*2/3)
+                columns, score, err := DefaultSolver().BestMoves(ctx, &board)
+                cancel()
+                if err != nil {
+                        t.Errorf("BestMoves after %s: %v", moves, err)
+                        continue
+                }
+
+                want, err := DefaultSolver().Solve(context.Background(), &board)
+                if err != nil {
+                        t.Fatal(err)
+                }
+                if score != want || len(columns) == 0 {
+                        t.Errorf("BestMoves after %s = %v, %d, want the position's score %d", moves, columns, score, want)
+                }
+        }
+}
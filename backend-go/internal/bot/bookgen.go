@@ -0,0 +1,60 @@
+package bot
+
+import (
+        "context"
+)
+
+// GenerateOpeningBook solves every position reachable in at most maxDepth
+// moves, up to mirror symmetry, deepest first so that shallower searches can
+// use the scores already found. progress, if set, is called after each
+// position is solved.
+func (s *Solver) GenerateOpeningBook(ctx context.Context, maxDepth int, progress func(depth, done, total int)) (*OpeningBook, error) {
+        levels := [][]position{{{}}}
+        for depth := 1; depth <= maxDepth; depth++ {
+                seen := make(map[uint64]bool)
+                next := []position{}
+                for _, pos := range levels[depth-1] {
+                        for col := 0; col < solverWidth; col++ {
+                                if !pos.canPlay(col) || pos.isWinningMove(col) {
+                                        continue
+                                }
+                                child := pos
+                                child.play(child.columnMove(col))
+                                if key := bookKey(&child); !seen[key] {
+                                        seen[key] = true
+                                        next = append(next, child)
+                                }
+                        }
+                }
+                levels = append(levels, next)
+        }
+
+        search, err := s.acquire(ctx)
+        if err != nil {
+                return nil, err
+        }
+        defer s.release(search)
+
+        // The search looks up the positions solved so far, deeper ones
+        // first, in place of the solver's own book.
+        book := NewOpeningBook(maxDepth)
+        search.book = book
+        defer func() { search.book = s.book }()
+
+        for depth := maxDepth; depth >= 0; depth-- {
+                for i, pos := range levels[depth] {
+                        if pos.canWinNext() {
+                                continue
+                        }
+                        score, err := search.run(ctx, func() int { return search.solve(pos, false) })
+                        if err != nil {
+                                return nil, err
+                        }
+                        book.add(&pos, score)
+                        if progress != nil {
+                                progress(depth, i+1, len(levels[depth]))
+                        }
+                }
+        }
+        return book, nil
+}
@@ -8,48 +8,118 @@ import (
 
 const BotUsername = "AI Bot"
 
-func SelectBotMove(board *game.Board, botPlayer game.Player) int {
+func SelectBotMove(board *game.Board, rules game.Rules, botPlayer game.Player) (game.MoveKind, int) {
         opponent := game.Player1
         if botPlayer == game.Player1 {
                 opponent = game.Player2
         }
 
-        if winningMove := findWinningMove(board, botPlayer); winningMove != -1 {
-                return winningMove
+        if winningMove := findWinningMove(board, rules, botPlayer); winningMove != -1 {
+                return game.MoveDrop, winningMove
         }
 
-        if blockingMove := findWinningMove(board, opponent); blockingMove != -1 {
-                return blockingMove
+        if rules.PopOut {
+                if winningPop := findWinningPop(board, rules, botPlayer); winningPop != -1 {
+                        return game.MovePop, winningPop
+                }
         }
 
-        if strategicMove := findStrategicMove(board, botPlayer); strategicMove != -1 {
-                return strategicMove
+        if blockingMove := findWinningMove(board, rules, opponent); blockingMove != -1 {
+                return game.MoveDrop, blockingMove
         }
 
         validCols := game.GetValidColumns(board)
+        if len(validCols) == 0 {
+                return game.MovePop, selectSafePop(board, rules, botPlayer)
+        }
+
+        if strategicMove := findStrategicMove(board, rules, botPlayer); strategicMove != -1 {
+                return game.MoveDrop, strategicMove
+        }
+
         centerCols := []int{}
+        center := board.Cols() / 2
         for _, col := range validCols {
-                if col >= 2 && col <= 4 {
+                if col >= center-1 && col <= center+1 {
                         centerCols = append(centerCols, col)
                 }
         }
         if len(centerCols) > 0 {
-                return centerCols[rand.Intn(len(centerCols))]
+                return game.MoveDrop, centerCols[rand.Intn(len(centerCols))]
+        }
+
+        return game.MoveDrop, validCols[rand.Intn(len(validCols))]
+}
+
+func findWinningPop(board *game.Board, rules game.Rules, player game.Player) int {
+        for _, col := range game.GetValidPops(board, player) {
+                testBoard := board.Clone()
+                if _, err := game.PopMove(&testBoard, col, player); err != nil {
+                        continue
+                }
+                winner, _ := game.ResolveWinner(&testBoard, rules, player)
+                if winner == player {
+                        return col
+                }
+        }
+
+        return -1
+}
+
+// selectSafePop picks a pop that does not hand the opponent a line, falling
+// back to any legal pop when every one of them loses.
+func selectSafePop(board *game.Board, rules game.Rules, player game.Player) int {
+        validPops := game.GetValidPops(board, player)
+        if len(validPops) == 0 {
+                return -1
         }
 
-        return validCols[rand.Intn(len(validCols))]
+        for _, col := range validPops {
+                testBoard := board.Clone()
+                if _, err := game.PopMove(&testBoard, col, player); err != nil {
+                        continue
+                }
+                winner, _ := game.ResolveWinner(&testBoard, rules, player)
+                if winner == game.Empty {
+                        return col
+                }
+        }
+
+        return validPops[rand.Intn(len(validPops))]
+}
+
+func findWinningMove(board *game.Board, rules game.Rules, player game.Player) int {
+        bb, err := game.BitboardFromBoard(*board, rules)
+        if err != nil {
+                return findWinningMoveScan(board, rules, player)
+        }
+
+        for col := 0; col < bb.Cols(); col++ {
+                if !bb.CanPlay(col) {
+                        continue
+                }
+                next := bb
+                next.Play(col, player)
+                if next.HasWon(player) {
+                        return col
+                }
+        }
+
+        return -1
 }
 
-func findWinningMove(board *game.Board, player game.Player) int {
+// findWinningMoveScan is findWinningMove for boards too large for a
+// bitboard.
+func findWinningMoveScan(board *game.Board, rules game.Rules, player game.Player) int {
         validCols := game.GetValidColumns(board)
 
         for _, col := range validCols {
-                testBoard := *board
+                testBoard := board.Clone()
                 _, err := game.MakeMove(&testBoard, col, player)
                 if err != nil {
                         continue
                 }
-                winner, _ := game.CheckWinner(&testBoard)
+                winner, _ := game.CheckWinner(&testBoard, rules)
                 if winner == player {
                         return col
                 }
@@ -58,13 +128,13 @@ func findWinningMove(board *game.Board, player game.Player) int {
         return -1
 }
 
-func findStrategicMove(board *game.Board, player game.Player) int {
+func findStrategicMove(board *game.Board, rules game.Rules, player game.Player) int {
         validCols := game.GetValidColumns(board)
         bestScore := math.Inf(-1)
         bestCol := -1
 
         for _, col := range validCols {
-                score := evaluateColumn(board, col, player)
+                score := evaluateColumn(board, rules, col, player)
                 if score > bestScore {
                         bestScore = score
                         bestCol = col
@@ -74,8 +144,8 @@ func findStrategicMove(board *game.Board, player game.Player) int {
         return bestCol
 }
 
-func evaluateColumn(board *game.Board, column int, player game.Player) float64 {
-        testBoard := *board
+func evaluateColumn(board *game.Board, rules game.Rules, column int, player game.Player) float64 {
+        testBoard := board.Clone()
         move, err := game.MakeMove(&testBoard, column, player)
         if err != nil {
                 return math.Inf(-1)
@@ -84,28 +154,28 @@ func evaluateColumn(board *game.Board, column int, player game.Player) float64 {
         row := move.Row
         score := 0.0
 
-        score += evaluateLine(&testBoard, row, column, 0, 1, player)
-        score += evaluateLine(&testBoard, row, column, 1, 0, player)
-        score += evaluateLine(&testBoard, row, column, 1, 1, player)
-        score += evaluateLine(&testBoard, row, column, 1, -1, player)
+        score += evaluateLine(&testBoard, rules, row, column, 0, 1, player)
+        score += evaluateLine(&testBoard, rules, row, column, 1, 0, player)
+        score += evaluateLine(&testBoard, rules, row, column, 1, 1, player)
+        score += evaluateLine(&testBoard, rules, row, column, 1, -1, player)
 
         return score
 }
 
-func evaluateLine(board *game.Board, row, col, dRow, dCol int, player game.Player) float64 {
+func evaluateLine(board *game.Board, rules game.Rules, row, col, dRow, dCol int, player game.Player) float64 {
         count := 0
         empty := 0
 
         for dir := -1; dir <= 1; dir += 2 {
-                for i := 1; i < 4; i++ {
+                for i := 1; i < rules.WinLength; i++ {
                         r := row + dRow*i*dir
                         c := col + dCol*i*dir
 
-                        if r < 0 || r >= game.Rows || c < 0 || c >= game.Cols {
+                        if r < 0 || r >= board.Rows() || c < 0 || c >= board.Cols() {
                                 break
                         }
 
-                        cell := board[r][c]
+                        cell := (*board)[r][c]
                         if cell == player {
                                 count++
                         } else if cell == game.Empty {
@@ -0,0 +1,125 @@
+package bot
+
+import (
+        "context"
+        "fmt"
+        "fourinrow/internal/game"
+        "strings"
+        "time"
+)
+
+type Difficulty string
+
+const (
+        Easy    Difficulty = "easy"
+        Medium  Difficulty = "medium"
+        Hard    Difficulty = "hard"
+        Perfect Difficulty = "perfect"
+)
+
+const DefaultDifficulty = Medium
+
+// Level is how hard the bot searches at a difficulty: negamax deepens one
+// ply at a time up to Depth and plays the best move of the last depth it
+// completed within TimeBudget. A zero Depth plays the one-ply heuristic in
+// SelectBotMove.
+type Level struct {
+        Depth       int
+        TimeBudget  time.Duration
+        Description string
+}
+
+var Levels = map[Difficulty]Level{
+        Easy: {
+                Description: "Wins or blocks when it can, otherwise builds lines near the center",
+        },
+        Medium: {
+                Depth:       4,
+                TimeBudget:  100 * time.Millisecond,
+                Description: "Negamax searching up to 4 plies ahead in 100ms",
+        },
+        Hard: {
+                Depth:       10,
+                TimeBudget:  500 * time.Millisecond,
+                Description: "Negamax searching up to 10 plies ahead in 500ms",
+        },
+        Perfect: {
+                Depth:       maxPly,
+                TimeBudget:  1500 * time.Millisecond,
+                Description: "Plays the standard board perfectly from its opening book or when the solver finishes within 1s, otherwise searches as deep as 1.5s allows",
+        },
+}
+
+func ParseDifficulty(name string) (Difficulty, error) {
+        if name == "" {
+                return DefaultDifficulty, nil
+        }
+        difficulty := Difficulty(strings.ToLower(name))
+        if _, ok := Levels[difficulty]; !ok {
+                return "", fmt.Errorf("unknown difficulty %q", name)
+        }
+        return difficulty, nil
+}
+
+// Name is the difficulty itself, under which it is registered in Bots.
+func (d Difficulty) Name() string {
+        return string(d)
+}
+
+func (d Difficulty) Description() string {
+        return Levels[d].Description
+}
+
+// SelectMove plays negamax at difficulty d.
+func (d Difficulty) SelectMove(ctx context.Context, board *game.Board, rules game.Rules, botPlayer game.Player) (game.MoveKind, int) {
+        return SelectMove(ctx, d, board, rules, botPlayer)
+}
+
+// DisplayName is the name the bot plays under at this difficulty, e.g.
+// "AI Bot (Hard)".
+func (d Difficulty) DisplayName() string {
+        if d == "" {
+                return BotUsername
+        }
+        return fmt.Sprintf("%s (%s%s)", BotUsername, strings.ToUpper(string(d[:1])), d[1:])
+}
+
+// SelectMove picks a move for botPlayer at the given difficulty, returning
+// by the earlier of ctx's deadline and the difficulty's time budget. Negamax
+// only handles drops on boards that fit a bitboard, so PopOut games and the
+// largest boards are played with the heuristic at every difficulty. Perfect
+// play on the standard board comes from the solver; if it cannot finish in
+// two thirds of the budget, negamax uses the rest.
+func SelectMove(ctx context.Context, difficulty Difficulty, board *game.Board, rules game.Rules, botPlayer game.Player) (game.MoveKind, int) {
+        level := Levels[difficulty]
+        if level.Depth == 0 || rules.PopOut {
+                return SelectBotMove(board, rules, botPlayer)
+        }
+
+        bb, err := game.BitboardFromBoard(*board, rules)
+        if err != nil {
+                return SelectBotMove(board, rules, botPlayer)
+        }
+
+        budget := level.TimeBudget
+        if difficulty == Perfect && rules == game.DefaultRules() {
+                solveCtx, cancel := context.WithTimeout(ctx, budget*2/3)
+                columns, _, err := DefaultSolver().BestMoves(solveCtx, board)
+                cancel()
+                if err == nil {
+                        return game.MoveDrop, columns[0]
+                }
+                budget -= budget * 2 / 3
+        }
+
+        ctx, cancel := context.WithTimeout(ctx, budget)
+        defer cancel()
+
+        search := newSearcher(ctx, rules)
+        column := search.bestMove(&bb, botPlayer, level.Depth)
+        search.release()
+        if column == -1 {
+                return SelectBotMove(board, rules, botPlayer)
+        }
+        return game.MoveDrop, column
+}
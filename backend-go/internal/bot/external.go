@@ -0,0 +1,244 @@
+package bot
+
+import (
+        "bufio"
+        "context"
+        "encoding/json"
+        "errors"
+        "fmt"
+        "fourinrow/internal/game"
+        "io"
+        "log"
+        "os"
+        "os/exec"
+        "strconv"
+        "strings"
+)
+
+// External bot protocol. The server starts the engine once and talks to it
+// over its standard input and output, one line per message. For every move
+// the server writes
+//
+//      position <rows> <cols> <winLength> <popout> <player> <board>
+//
+// where popout is 1 in PopOut games and 0 otherwise, player is the engine's
+// player number (1 or 2) and board lists the rows from top to bottom,
+// separated by '/', with one digit per cell: 0 for empty, 1 and 2 for the
+// players' discs. For example, after the first player drops into the center
+// of a standard board:
+//
+//      position 6 7 4 0 2 0000000/0000000/0000000/0000000/0000000/0001000
+//
+// The engine answers with the column to drop into, counted from 0, or with
+// "pop <column>" in PopOut games. Lines starting with '#' are logged and
+// otherwise ignored. An engine that misses the deadline is killed, and one
+// that crashes is started again for the next move; either way, and after an
+// illegal answer, the server plays that move with the heuristic instead.
+
+// ExternalBotConfig describes an engine in the file read by
+// LoadExternalBots.
+type ExternalBotConfig struct {
+        Name        string   `json:"name"`
+        Description string   `json:"description"`
+        Command     string   `json:"command"`
+        Args        []string `json:"args"`
+}
+
+// ExternalBot is a Strategy backed by an engine in a subprocess. Moves are
+// requested one at a time, so games against the same engine take turns.
+// External bots play under their own name and appear on the leaderboard.
+type ExternalBot struct {
+        config ExternalBotConfig
+        // turn holds a token while no move is being requested.
+        turn chan struct{}
+
+        cmd   *exec.Cmd
+        stdin io.WriteCloser
+        lines chan string
+}
+
+func NewExternalBot(config ExternalBotConfig) *ExternalBot {
+        external := &ExternalBot{config: config, turn: make(chan struct{}, 1)}
+        external.turn <- struct{}{}
+        return external
+}
+
+// LoadExternalBots reads a JSON array of ExternalBotConfig.
+func LoadExternalBots(path string) ([]*ExternalBot, error) {
+        data, err := os.ReadFile(path)
+        if err != nil {
+                return nil, err
+        }
+        var configs []ExternalBotConfig
+        if err := json.Unmarshal(data, &configs); err != nil {
+                return nil, fmt.Errorf("%s: %w", path, err)
+        }
+
+        bots := make([]*ExternalBot, 0, len(configs))
+        for _, config := range configs {
+                if config.Name == "" || config.Command == "" {
+                        return nil, fmt.Errorf("%s: every bot needs a name and a command", path)
+                }
+                bots = append(bots, NewExternalBot(config))
+        }
+        return bots, nil
+}
+
+func (b *ExternalBot) Name() string {
+        return b.config.Name
+}
+
+func (b *ExternalBot) Description() string {
+        if b.config.Description == "" {
+                return "External engine " + b.config.Command
+        }
+        return b.config.Description
+}
+
+// OnLeaderboard reports that games against this bot count towards its own
+// stats.
+func (b *ExternalBot) OnLeaderboard() bool {
+        return true
+}
+
+// SelectMove asks the engine for a move, falling back to the heuristic if
+// it cannot answer with a legal one before ctx is done.
+func (b *ExternalBot) SelectMove(ctx context.Context, board *game.Board, rules game.Rules, botPlayer game.Player) (game.MoveKind, int) {
+        kind, column, err := b.requestMove(ctx, board, rules, botPlayer)
+        if err != nil {
+                log.Printf("External bot %s failed, playing the heuristic move: %v", b.config.Name, err)
+                return SelectBotMove(board, rules, botPlayer)
+        }
+        return kind, column
+}
+
+func (b *ExternalBot) requestMove(ctx context.Context, board *game.Board, rules game.Rules, botPlayer game.Player) (game.MoveKind, int, error) {
+        select {
+        case <-b.turn:
+        case <-ctx.Done():
+                return "", 0, ctx.Err()
+        }
+        defer func() { b.turn <- struct{}{} }()
+
+        if b.cmd == nil {
+                if err := b.start(); err != nil {
+                        return "", 0, err
+                }
+        }
+
+        if _, err := io.WriteString(b.stdin, encodePosition(board, rules, botPlayer)+"\n"); err != nil {
+                b.stop()
+                return "", 0, err
+        }
+
+        for {
+                select {
+                case line, ok := <-b.lines:
+                        if !ok {
+                                b.stop()
+                                return "", 0, errors.New("engine exited")
+                        }
+                        if strings.HasPrefix(line, "#") {
+                                log.Printf("External bot %s: %s", b.config.Name, line)
+                                continue
+                        }
+                        // An engine that answers with nonsense may have more
+                        // of it queued up for the next position, so it is
+                        // restarted just as if it had missed the deadline.
+                        kind, column, err := parseEngineMove(line)
+                        if err != nil {
+                                b.stop()
+                                return "", 0, err
+                        }
+                        if !isLegalMove(board, rules, kind, column, botPlayer) {
+                                b.stop()
+                                return "", 0, fmt.Errorf("illegal move %q", line)
+                        }
+                        return kind, column, nil
+                case <-ctx.Done():
+                        b.stop()
+                        return "", 0, fmt.Errorf("no move before the deadline: %w", ctx.Err())
+                }
+        }
+}
+
+func (b *ExternalBot) start() error {
+        cmd := exec.Command(b.config.Command, b.config.Args...)
+        cmd.Stderr = os.Stderr
+        stdin, err := cmd.StdinPipe()
+        if err != nil {
+                return err
+        }
+        stdout, err := cmd.StdoutPipe()
+        if err != nil {
+                return err
+        }
+        if err := cmd.Start(); err != nil {
+                return err
+        }
+
+        lines := make(chan string)
+        go func() {
+                defer close(lines)
+                scanner := bufio.NewScanner(stdout)
+                for scanner.Scan() {
+                        lines <- strings.TrimSpace(scanner.Text())
+                }
+        }()
+
+        log.Printf("Started external bot %s (pid %d)", b.config.Name, cmd.Process.Pid)
+        b.cmd, b.stdin, b.lines = cmd, stdin, lines
+        return nil
+}
+
+// stop kills the engine so the next move starts a fresh one.
+func (b *ExternalBot) stop() {
+        if b.cmd == nil {
+                return
+        }
+        b.stdin.Close()
+        b.cmd.Process.Kill()
+        // Drain the reader so it sees EOF and Wait can collect the process.
+        go func(lines chan string, cmd *exec.Cmd) {
+                for range lines {
+                }
+                cmd.Wait()
+        }(b.lines, b.cmd)
+        b.cmd, b.stdin, b.lines = nil, nil, nil
+}
+
+func encodePosition(board *game.Board, rules game.Rules, player game.Player) string {
+        popOut := 0
+        if rules.PopOut {
+                popOut = 1
+        }
+
+        rows := make([]string, 0, board.Rows())
+        for _, cells := range *board {
+                var row strings.Builder
+                for _, cell := range cells {
+                        row.WriteByte(byte('0' + cell))
+                }
+                rows = append(rows, row.String())
+        }
+        return fmt.Sprintf("position %d %d %d %d %d %s", board.Rows(), board.Cols(), rules.WinLength, popOut, player, strings.Join(rows, "/"))
+}
+
+func parseEngineMove(line string) (game.MoveKind, int, error) {
+        kind := game.MoveDrop
+        if rest, ok := strings.CutPrefix(line, "pop "); ok {
+                kind, line = game.MovePop, rest
+        }
+        column, err := strconv.Atoi(strings.TrimSpace(line))
+        if err != nil {
+                return "", 0, fmt.Errorf("unreadable move %q", line)
+        }
+        return kind, column, nil
+}
+
+func isLegalMove(board *game.Board, rules game.Rules, kind game.MoveKind, column int, player game.Player) bool {
+        if kind == game.MovePop {
+                return rules.PopOut && game.IsValidPop(board, column, player)
+        }
+        return game.IsValidMove(board, column)
+}
@@ -0,0 +1,188 @@
+package bot
+
+import (
+        "context"
+        "fmt"
+        "fourinrow/internal/game"
+        "math"
+        "math/rand"
+        "time"
+)
+
+// MCTSName is the name the MCTS bot is registered under.
+const MCTSName = "mcts"
+
+// DefaultPlayouts is the number of simulated games the MCTS bot plays per
+// move unless configured otherwise.
+const DefaultPlayouts = 5000
+
+// mctsTimeBudget caps how long a move may take however many playouts are
+// configured.
+const mctsTimeBudget = time.Second
+
+// mctsExploration is the UCT exploration constant. Higher values spread
+// playouts over more columns.
+const mctsExploration = 1.2
+
+// MCTS is a Monte Carlo Tree Search bot. It grows a game tree by UCT,
+// scores new nodes with a random playout to the end of the game and plays
+// the column visited most. Random playouts make it miss deep tactics but
+// vary its play from game to game. Like negamax it only handles drops on
+// boards that fit a bitboard, falling back to the heuristic otherwise.
+type MCTS struct {
+        Playouts int
+}
+
+func NewMCTS(playouts int) *MCTS {
+        if playouts <= 0 {
+                playouts = DefaultPlayouts
+        }
+        return &MCTS{Playouts: playouts}
+}
+
+func (m *MCTS) Name() string {
+        return MCTSName
+}
+
+func (m *MCTS) Description() string {
+        return fmt.Sprintf("Monte Carlo Tree Search with %d random playouts per move; varies its play", m.Playouts)
+}
+
+func (m *MCTS) DisplayName() string {
+        return BotUsername + " (MCTS)"
+}
+
+type mctsNode struct {
+        parent   *mctsNode
+        children []*mctsNode
+        untried  []int
+
+        // column is the move that led here, played by player. wins counts
+        // playouts through this node won by player, with draws as half.
+        column int
+        player game.Player
+        visits int
+        wins   float64
+        winner game.Player
+        ended  bool
+}
+
+func newMCTSNode(parent *mctsNode, bb *game.Bitboard, column int, player game.Player) *mctsNode {
+        node := &mctsNode{parent: parent, column: column, player: player}
+        if parent != nil && bb.HasWon(player) {
+                node.winner, node.ended = player, true
+                return node
+        }
+        if bb.IsFull() {
+                node.ended = true
+                return node
+        }
+        node.untried = bb.ValidColumns()
+        return node
+}
+
+// SelectMove runs Playouts simulations, or as many as fit before ctx is
+// done or mctsTimeBudget runs out, and returns the most visited column.
+func (m *MCTS) SelectMove(ctx context.Context, board *game.Board, rules game.Rules, botPlayer game.Player) (game.MoveKind, int) {
+        if rules.PopOut {
+                return SelectBotMove(board, rules, botPlayer)
+        }
+        root, err := game.BitboardFromBoard(*board, rules)
+        if err != nil || root.IsFull() {
+                return SelectBotMove(board, rules, botPlayer)
+        }
+        if winningMove := findWinningMove(board, rules, botPlayer); winningMove != -1 {
+                return game.MoveDrop, winningMove
+        }
+
+        ctx, cancel := context.WithTimeout(ctx, mctsTimeBudget)
+        defer cancel()
+
+        r := rand.New(rand.NewSource(time.Now().UnixNano()))
+        tree := newMCTSNode(nil, &root, -1, botPlayer.Opponent())
+        for i := 0; i < m.Playouts; i++ {
+                if i%64 == 0 && ctx.Err() != nil {
+                        break
+                }
+
+                bb := root
+                node := tree
+                for len(node.untried) == 0 && !node.ended {
+                        node = node.selectChild()
+                        bb.Play(node.column, node.player)
+                }
+
+                if len(node.untried) > 0 {
+                        j := r.Intn(len(node.untried))
+                        col := node.untried[j]
+                        node.untried = append(node.untried[:j], node.untried[j+1:]...)
+                        player := node.player.Opponent()
+                        bb.Play(col, player)
+                        child := newMCTSNode(node, &bb, col, player)
+                        node.children = append(node.children, child)
+                        node = child
+                }
+
+                winner := node.winner
+                if !node.ended {
+                        winner = playout(&bb, node.player.Opponent(), r)
+                }
+
+                for ; node != nil; node = node.parent {
+                        node.visits++
+                        if winner == node.player {
+                                node.wins++
+                        } else if winner == game.Empty {
+                                node.wins += 0.5
+                        }
+                }
+        }
+
+        var best *mctsNode
+        for _, child := range tree.children {
+                if best == nil || child.visits > best.visits {
+                        best = child
+                }
+        }
+        if best == nil {
+                return SelectBotMove(board, rules, botPlayer)
+        }
+        return game.MoveDrop, best.column
+}
+
+// selectChild picks the child with the highest UCT value.
+func (n *mctsNode) selectChild() *mctsNode {
+        logVisits := math.Log(float64(n.visits))
+        var best *mctsNode
+        bestValue := math.Inf(-1)
+        for _, child := range n.children {
+                value := child.wins/float64(child.visits) + mctsExploration*math.Sqrt(logVisits/float64(child.visits))
+                if value > bestValue {
+                        best, bestValue = child, value
+                }
+        }
+        return best
+}
+
+// playout plays random moves from bb, starting with player, and returns the
+// winner, or Empty for a draw.
+func playout(bb *game.Bitboard, player game.Player, r *rand.Rand) game.Player {
+        var columns [game.MaxBitboardCols]int
+        for {
+                n := 0
+                for col := 0; col < bb.Cols(); col++ {
+                        if bb.CanPlay(col) {
+                                columns[n] = col
+                                n++
+                        }
+                }
+                if n == 0 {
+                        return game.Empty
+                }
+                bb.Play(columns[r.Intn(n)], player)
+                if bb.HasWon(player) {
+                        return player
+                }
+                player = player.Opponent()
+        }
+}
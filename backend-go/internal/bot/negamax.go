@@ -0,0 +1,324 @@
+package bot
+
+import (
+        "context"
+        "fourinrow/internal/game"
+        "math/bits"
+)
+
+// winScore is the value of winning right now. Wins further down the tree
+// score one less per ply so the search prefers the quickest win and the
+// slowest loss.
+const winScore = 1 << 20
+
+// maxPly bounds the length of any game that fits a bitboard.
+const maxPly = 64
+
+// checkInterval is how many nodes are searched between deadline checks.
+const checkInterval = 4096
+
+type searcher struct {
+        rows    int
+        windows []uint64
+        weights []int
+        order   []int
+        table   *transpositionTable
+
+        ctx       context.Context
+        nodes     int
+        stoppable bool
+        stopped   bool
+}
+
+func newSearcher(ctx context.Context, rules game.Rules) *searcher {
+        weights := make([]int, rules.WinLength)
+        for i := 1; i < rules.WinLength; i++ {
+                weights[i] = 1 << (2 * (i - 1))
+        }
+
+        return &searcher{
+                rows:    rules.Rows,
+                windows: game.BitboardWindows(rules),
+                weights: weights,
+                order:   centerOrder(rules.Cols),
+                table:   acquireTranspositionTable(),
+                ctx:     ctx,
+        }
+}
+
+// release hands the searcher's transposition table back for reuse. The
+// searcher must not be used afterwards.
+func (s *searcher) release() {
+        releaseTranspositionTable(s.table)
+        s.table = nil
+}
+
+// centerOrder lists the columns from the center outwards, which is the
+// order most likely to produce early alpha-beta cutoffs.
+func centerOrder(cols int) []int {
+        center := cols / 2
+        order := []int{center}
+        for d := 1; len(order) < cols; d++ {
+                if center-d >= 0 {
+                        order = append(order, center-d)
+                }
+                if center+d < cols {
+                        order = append(order, center+d)
+                }
+        }
+        return order
+}
+
+// bestMove searches one ply deeper at a time, up to maxDepth, and returns
+// the best column of the last depth that finished before the context was
+// done. The first depth always finishes. It returns -1 on a full board.
+func (s *searcher) bestMove(bb *game.Bitboard, player game.Player, maxDepth int) int {
+        if empty := s.rows*bb.Cols() - bb.MoveCount(); maxDepth > empty {
+                maxDepth = empty
+        }
+
+        key := zobristHash(bb, player)
+        bestCol := -1
+        for depth := 1; depth <= maxDepth; depth++ {
+                col, score := s.searchRoot(bb, key, player, depth)
+                if s.stopped {
+                        break
+                }
+                bestCol = col
+                s.stoppable = true
+
+                if isWinScore(score) {
+                        break
+                }
+        }
+        return bestCol
+}
+
+// scoreMoves deepens like bestMove but searches every column with a full
+// window, so the scores can be compared with each other. It returns the
+// scores of the last depth that finished, indexed by column, and that depth.
+func (s *searcher) scoreMoves(bb *game.Bitboard, player game.Player, maxDepth int) ([]int, int) {
+        if empty := s.rows*bb.Cols() - bb.MoveCount(); maxDepth > empty {
+                maxDepth = empty
+        }
+
+        key := zobristHash(bb, player)
+        scores := make([]int, bb.Cols())
+        completed := 0
+        for depth := 1; depth <= maxDepth; depth++ {
+                current := make([]int, bb.Cols())
+                decided := true
+                for _, col := range s.order {
+                        if !bb.CanPlay(col) {
+                                continue
+                        }
+
+                        childKey := key ^ s.moveKey(bb, col, player)
+                        bb.Play(col, player)
+                        if bb.HasWon(player) {
+                                current[col] = winScore
+                        } else {
+                                current[col] = -s.negamax(bb, childKey, player.Opponent(), depth-1, -winScore, winScore, 1)
+                        }
+                        bb.Undo(col)
+                        if s.stopped {
+                                return scores, completed
+                        }
+                        decided = decided && isWinScore(current[col])
+                }
+                scores, completed = current, depth
+                s.stoppable = true
+
+                if decided {
+                        break
+                }
+        }
+        return scores, completed
+}
+
+func (s *searcher) searchRoot(bb *game.Bitboard, key uint64, player game.Player, depth int) (int, int) {
+        hashMove := -1
+        if entry, ok := s.table.probe(key); ok {
+                hashMove = int(entry.move)
+        }
+
+        bestCol := -1
+        alpha, beta := -winScore, winScore
+        for i := -1; i < len(s.order); i++ {
+                col := s.nextColumn(i, hashMove)
+                if col < 0 || !bb.CanPlay(col) {
+                        continue
+                }
+
+                childKey := key ^ s.moveKey(bb, col, player)
+                bb.Play(col, player)
+                var score int
+                if bb.HasWon(player) {
+                        score = winScore
+                } else {
+                        score = -s.negamax(bb, childKey, player.Opponent(), depth-1, -beta, -alpha, 1)
+                }
+                bb.Undo(col)
+                if s.stopped {
+                        return bestCol, alpha
+                }
+
+                if bestCol == -1 || score > alpha {
+                        bestCol = col
+                        alpha = score
+                }
+        }
+
+        s.table.store(key, depth, alpha, exactBound, bestCol)
+        return bestCol, alpha
+}
+
+// negamax scores the position for player, who is about to move, searching
+// depth plies with alpha-beta pruning.
+func (s *searcher) negamax(bb *game.Bitboard, key uint64, player game.Player, depth, alpha, beta, ply int) int {
+        s.nodes++
+        if s.stoppable && s.nodes%checkInterval == 0 && s.ctx.Err() != nil {
+                s.stopped = true
+        }
+        if s.stopped {
+                return 0
+        }
+
+        for _, col := range s.order {
+                if !bb.CanPlay(col) {
+                        continue
+                }
+                bb.Play(col, player)
+                won := bb.HasWon(player)
+                bb.Undo(col)
+                if won {
+                        return winScore - ply
+                }
+        }
+
+        if bb.IsFull() {
+                return 0
+        }
+        if depth <= 0 {
+                return s.evaluate(bb, player)
+        }
+
+        originalAlpha := alpha
+        hashMove := -1
+        if entry, ok := s.table.probe(key); ok {
+                hashMove = int(entry.move)
+                if int(entry.depth) >= depth {
+                        score := fromTableScore(int(entry.score), ply)
+                        switch entry.flag {
+                        case exactBound:
+                                return score
+                        case lowerBound:
+                                alpha = max(alpha, score)
+                        case upperBound:
+                                beta = min(beta, score)
+                        }
+                        if alpha >= beta {
+                                return score
+                        }
+                }
+        }
+
+        best, bestCol := -winScore, -1
+        for i := -1; i < len(s.order); i++ {
+                col := s.nextColumn(i, hashMove)
+                if col < 0 || !bb.CanPlay(col) {
+                        continue
+                }
+
+                childKey := key ^ s.moveKey(bb, col, player)
+                bb.Play(col, player)
+                score := -s.negamax(bb, childKey, player.Opponent(), depth-1, -beta, -alpha, ply+1)
+                bb.Undo(col)
+                if s.stopped {
+                        return 0
+                }
+
+                if score > best {
+                        best, bestCol = score, col
+                }
+                if best > alpha {
+                        alpha = best
+                }
+                if alpha >= beta {
+                        break
+                }
+        }
+
+        flag := exactBound
+        if best <= originalAlpha {
+                flag = upperBound
+        } else if best >= beta {
+                flag = lowerBound
+        }
+        s.table.store(key, depth, toTableScore(best, ply), flag, bestCol)
+        return best
+}
+
+// nextColumn yields the hash move first (i == -1) and then the center
+// order without repeating it.
+func (s *searcher) nextColumn(i, hashMove int) int {
+        if i < 0 {
+                return hashMove
+        }
+        if s.order[i] == hashMove {
+                return -1
+        }
+        return s.order[i]
+}
+
+// moveKey is the Zobrist delta of player dropping into col, including the
+// change of side to move.
+func (s *searcher) moveKey(bb *game.Bitboard, col int, player game.Player) uint64 {
+        bit := col*(s.rows+1) + int(bb.Heights[col])
+        return zobristKeys[player-1][bit] ^ zobristSide
+}
+
+// evaluate counts the lines each side could still complete, weighting them
+// by how many discs they already hold.
+func (s *searcher) evaluate(bb *game.Bitboard, player game.Player) int {
+        mine := bb.Masks[player-1]
+        theirs := bb.Masks[player.Opponent()-1]
+
+        score := 0
+        for _, window := range s.windows {
+                own := bits.OnesCount64(window & mine)
+                other := bits.OnesCount64(window & theirs)
+                if other == 0 {
+                        score += s.weights[own]
+                } else if own == 0 {
+                        score -= s.weights[other]
+                }
+        }
+        return score
+}
+
+func isWinScore(score int) bool {
+        return score > winScore-maxPly || score < -winScore+maxPly
+}
+
+// toTableScore stores win scores as distance from the node rather than
+// from the root, so they stay valid wherever the position is reached.
+func toTableScore(score, ply int) int {
+        if score > winScore-maxPly {
+                return score + ply
+        }
+        if score < -winScore+maxPly {
+                return score - ply
+        }
+        return score
+}
+
+func fromTableScore(score, ply int) int {
+        if score > winScore-maxPly {
+                return score - ply
+        }
+        if score < -winScore+maxPly {
+                return score + ply
+        }
+        return score
+}
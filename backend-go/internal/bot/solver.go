@@ -0,0 +1,591 @@
+package bot
+
+import (
+        "context"
+        "errors"
+        "fmt"
+        "fourinrow/internal/game"
+        "math/bits"
+        "runtime"
+        "sync"
+)
+
+// The solver only handles the standard board, whose dimensions it bakes in
+// as constants. Positions use the Bitboard layout: column c takes bits
+// c*(solverHeight+1) upwards, bottom cell first, with a spare bit on top.
+const (
+        solverWidth  = game.Cols
+        solverHeight = game.Rows
+        solverCells  = solverWidth * solverHeight
+
+        minSolverScore = -solverCells/2 + 3
+        maxSolverScore = (solverCells+1)/2 - 3
+)
+
+var (
+        errNotSolvable  = errors.New("the solver only handles standard 7x6 boards")
+        errSolveStopped = errors.New("solver stopped before finishing")
+)
+
+// InvalidScore marks full columns in the scores returned by Analyze.
+const InvalidScore = -1000
+
+func solverColumnMask(col int) uint64 {
+        return ((1 << solverHeight) - 1) << (col * (solverHeight + 1))
+}
+
+func solverTopMask(col int) uint64 {
+        return 1 << (solverHeight - 1 + col*(solverHeight+1))
+}
+
+var (
+        solverBottomMask uint64
+        solverBoardMask  uint64
+)
+
+func init() {
+        for col := 0; col < solverWidth; col++ {
+                solverBottomMask |= 1 << (col * (solverHeight + 1))
+        }
+        solverBoardMask = solverBottomMask * ((1 << solverHeight) - 1)
+}
+
+// position is the solver's view of a board: the discs of the player to
+// move and of both players.
+type position struct {
+        current uint64
+        mask    uint64
+        moves   int
+}
+
+// positionFromBoard converts a standard board, working out whose turn it is
+// from the disc counts.
+func positionFromBoard(board *game.Board) (position, game.Player, error) {
+        if board.Rows() != solverHeight || board.Cols() != solverWidth {
+                return position{}, game.Empty, errNotSolvable
+        }
+        bb, err := game.BitboardFromBoard(*board, game.DefaultRules())
+        if err != nil {
+                return position{}, game.Empty, err
+        }
+        if bb.HasWon(game.Player1) || bb.HasWon(game.Player2) {
+                return position{}, game.Empty, errors.New("the game is already won")
+        }
+
+        ones := bits.OnesCount64(bb.Masks[0])
+        twos := bits.OnesCount64(bb.Masks[1])
+        toMove := game.Player1
+        if ones > twos {
+                toMove = game.Player2
+        }
+        if ones != twos && ones != twos+1 {
+                return position{}, game.Empty, errors.New("impossible disc counts")
+        }
+
+        return position{
+                current: bb.Masks[toMove-1],
+                mask:    bb.Masks[0] | bb.Masks[1],
+                moves:   ones + twos,
+        }, toMove, nil
+}
+
+func (p *position) canPlay(col int) bool {
+        return p.mask&solverTopMask(col) == 0
+}
+
+func (p *position) play(move uint64) {
+        p.current ^= p.mask
+        p.mask |= move
+        p.moves++
+}
+
+func (p *position) columnMove(col int) uint64 {
+        return (p.mask + (1 << (col * (solverHeight + 1)))) & solverColumnMask(col)
+}
+
+// key identifies the position together with the player to move.
+func (p *position) key() uint64 {
+        return p.current + p.mask
+}
+
+// mirrorKey is the key of the position reflected left to right.
+func (p *position) mirrorKey() uint64 {
+        var current, mask uint64
+        stride := solverHeight + 1
+        for col := 0; col < solverWidth; col++ {
+                shift := (solverWidth - 1 - 2*col) * stride
+                column := solverColumnMask(col)
+                if shift >= 0 {
+                        current |= (p.current & column) << shift
+                        mask |= (p.mask & column) << shift
+                } else {
+                        current |= (p.current & column) >> -shift
+                        mask |= (p.mask & column) >> -shift
+                }
+        }
+        return current + mask
+}
+
+func (p *position) possible() uint64 {
+        return (p.mask + solverBottomMask) & solverBoardMask
+}
+
+func (p *position) winningPosition() uint64 {
+        return computeWinningPosition(p.current, p.mask)
+}
+
+func (p *position) opponentWinningPosition() uint64 {
+        return computeWinningPosition(p.current^p.mask, p.mask)
+}
+
+func (p *position) canWinNext() bool {
+        return p.winningPosition()&p.possible() != 0
+}
+
+func (p *position) isWinningMove(col int) bool {
+        return p.winningPosition()&p.possible()&solverColumnMask(col) != 0
+}
+
+// possibleNonLosingMoves lists the playable cells that do not hand the
+// opponent an immediate win, or 0 when every move loses.
+func (p *position) possibleNonLosingMoves() uint64 {
+        possible := p.possible()
+        opponentWin := p.opponentWinningPosition()
+        forced := possible & opponentWin
+        if forced != 0 {
+                if forced&(forced-1) != 0 {
+                        return 0
+                }
+                possible = forced
+        }
+        return possible &^ (opponentWin >> 1)
+}
+
+// moveScore counts the winning cells a move creates, used to order moves.
+func (p *position) moveScore(move uint64) int {
+        return bits.OnesCount64(computeWinningPosition(p.current|move, p.mask))
+}
+
+// computeWinningPosition returns the empty cells that would complete a line
+// of four for the discs in pos.
+func computeWinningPosition(pos, mask uint64) uint64 {
+        const h = solverHeight
+
+        r := (pos << 1) & (pos << 2) & (pos << 3)
+
+        p := (pos << (h + 1)) & (pos << (2 * (h + 1)))
+        r |= p & (pos << (3 * (h + 1)))
+        r |= p & (pos >> (h + 1))
+        p = (pos >> (h + 1)) & (pos >> (2 * (h + 1)))
+        r |= p & (pos << (h + 1))
+        r |= p & (pos >> (3 * (h + 1)))
+
+        p = (pos << h) & (pos << (2 * h))
+        r |= p & (pos << (3 * h))
+        r |= p & (pos >> h)
+        p = (pos >> h) & (pos >> (2 * h))
+        r |= p & (pos << h)
+        r |= p & (pos >> (3 * h))
+
+        p = (pos << (h + 2)) & (pos << (2 * (h + 2)))
+        r |= p & (pos << (3 * (h + 2)))
+        r |= p & (pos >> (h + 2))
+        p = (pos >> (h + 2)) & (pos >> (2 * (h + 2)))
+        r |= p & (pos << (h + 2))
+        r |= p & (pos >> (3 * (h + 2)))
+
+        return r & (solverBoardMask ^ mask)
+}
+
+// solverTableSize is a prime just above 2^23. Keys are stored truncated to
+// 32 bits, which together with the index still identifies a position.
+const solverTableSize = 8388617
+
+type solverTable struct {
+        keys   []uint32
+        values []uint8
+}
+
+func newSolverTable() *solverTable {
+        return &solverTable{
+                keys:   make([]uint32, solverTableSize),
+                values: make([]uint8, solverTableSize),
+        }
+}
+
+func (t *solverTable) put(key uint64, value uint8) {
+        i := key % solverTableSize
+        t.keys[i] = uint32(key)
+        t.values[i] = value
+}
+
+func (t *solverTable) get(key uint64) uint8 {
+        i := key % solverTableSize
+        if t.keys[i] == uint32(key) {
+                return t.values[i]
+        }
+        return 0
+}
+
+// Solver plays the standard board perfectly. Scores follow the usual
+// convention for solved connect four: 0 is a draw, a positive score means
+// the player to move wins and is larger the sooner they win, a negative
+// score means they lose. Solver is safe for concurrent use: it runs a fixed
+// number of searches at once, each with a transposition table of its own
+// that it keeps from one search to the next, and further calls wait for a
+// search to finish, or for their context to be done.
+type Solver struct {
+        book  *OpeningBook
+        order [solverWidth]int
+        // searches holds the idle searches.
+        searches chan *solverSearch
+}
+
+// solverSearch is the state of one search.
+type solverSearch struct {
+        *Solver
+        book  *OpeningBook
+        table *solverTable
+
+        ctx     context.Context
+        nodes   int
+        stopped bool
+}
+
+// NewSolver returns a solver that runs one search at a time.
+func NewSolver(book *OpeningBook) *Solver {
+        return newSolver(book, 1)
+}
+
+func newSolver(book *OpeningBook, searches int) *Solver {
+        s := &Solver{book: book, searches: make(chan *solverSearch, searches)}
+        for i := 0; i < solverWidth; i++ {
+                s.order[i] = solverWidth/2 + (1-2*(i%2))*(i+1)/2
+        }
+        for i := 0; i < searches; i++ {
+                s.searches <- &solverSearch{Solver: s, book: book}
+        }
+        return s
+}
+
+// maxDefaultSearches bounds the searches DefaultSolver runs at once, and
+// with them the memory its transposition tables take.
+const maxDefaultSearches = 4
+
+var (
+        defaultSolver     *Solver
+        defaultSolverOnce sync.Once
+)
+
+// DefaultSolver returns a shared solver using the embedded opening book. It
+// runs a search per CPU, up to maxDefaultSearches, and each search's
+// transposition table takes about 40MB and is allocated on first use.
+func DefaultSolver() *Solver {
+        defaultSolverOnce.Do(func() {
+                defaultSolver = newSolver(DefaultOpeningBook(), min(runtime.NumCPU(), maxDefaultSearches))
+        })
+        return defaultSolver
+}
+
+// acquire waits for an idle search, giving up when ctx is done.
+func (s *Solver) acquire(ctx context.Context) (*solverSearch, error) {
+        select {
+        case search := <-s.searches:
+                return search, nil
+        case <-ctx.Done():
+                return nil, errSolveStopped
+        }
+}
+
+func (s *Solver) release(search *solverSearch) {
+        s.searches <- search
+}
+
+// Solve returns the score of board for the player to move.
+func (s *Solver) Solve(ctx context.Context, board *game.Board) (int, error) {
+        pos, _, err := positionFromBoard(board)
+        if err != nil {
+                return 0, err
+        }
+
+        search, err := s.acquire(ctx)
+        if err != nil {
+                return 0, err
+        }
+        defer s.release(search)
+        return search.run(ctx, func() int { return search.solve(pos, false) })
+}
+
+// Analyze returns the score of playing each column, from the point of view
+// of the player to move, with InvalidScore for full columns.
+func (s *Solver) Analyze(ctx context.Context, board *game.Board) ([]int, error) {
+        pos, _, err := positionFromBoard(board)
+        if err != nil {
+                return nil, err
+        }
+
+        search, err := s.acquire(ctx)
+        if err != nil {
+                return nil, err
+        }
+        defer s.release(search)
+
+        scores := make([]int, solverWidth)
+        for col := 0; col < solverWidth; col++ {
+                scores[col] = InvalidScore
+                if !pos.canPlay(col) {
+                        continue
+                }
+                if pos.isWinningMove(col) {
+                        scores[col] = (solverCells + 1 - pos.moves) / 2
+                        continue
+                }
+                next := pos
+                next.play(next.columnMove(col))
+                score, err := search.run(ctx, func() int { return -search.solve(next, false) })
+                if err != nil {
+                        return nil, err
+                }
+                scores[col] = score
+        }
+        return scores, nil
+}
+
+// BestMoves returns the columns that achieve the best score for the player
+// to move, and that score.
+func (s *Solver) BestMoves(ctx context.Context, board *game.Board) ([]int, int, error) {
+        scores, err := s.Analyze(ctx, board)
+        if err != nil {
+                return nil, 0, err
+        }
+
+        best := InvalidScore
+        columns := []int{}
+        for _, col := range centerOrder(solverWidth) {
+                switch {
+                case scores[col] == InvalidScore:
+                case scores[col] > best:
+                        best = scores[col]
+                        columns = []int{col}
+                case scores[col] == best:
+                        columns = append(columns, col)
+                }
+        }
+        if len(columns) == 0 {
+                return nil, 0, errors.New("no legal moves")
+        }
+        return columns, best, nil
+}
+
+// PositionValue describes the solved outcome of a position.
+type PositionValue struct {
+        Score  int         `json:"score"`
+        ToMove game.Player `json:"toMove"`
+        // Winner is Empty for a draw.
+        Winner game.Player `json:"winner"`
+        // MovesToWin counts the winner's moves, including the winning one,
+        // with best play from both sides.
+        MovesToWin int `json:"movesToWin,omitempty"`
+}
+
+func (v PositionValue) String() string {
+        if v.Winner == game.Empty {
+                return "draw"
+        }
+        return fmt.Sprintf("win in %d for player %d", v.MovesToWin, v.Winner)
+}
+
+// Evaluate solves board and describes the result.
+func (s *Solver) Evaluate(ctx context.Context, board *game.Board) (PositionValue, error) {
+        pos, toMove, err := positionFromBoard(board)
+        if err != nil {
+                return PositionValue{}, err
+        }
+        score, err := s.Solve(ctx, board)
+        if err != nil {
+                return PositionValue{}, err
+        }
+        return scoreValue(score, pos.moves, toMove), nil
+}
+
+// scoreValue turns a score for the player to move after the given number of
+// moves into the winner and how many more moves they need.
+func scoreValue(score, moves int, toMove game.Player) PositionValue {
+        value := PositionValue{Score: score, ToMove: toMove}
+        if score == 0 {
+                return value
+        }
+
+        winner, firstMove, s := toMove, moves, score
+        if score < 0 {
+                winner, firstMove, s = toMove.Opponent(), moves+1, -score
+        }
+        // The winner's final disc goes in when lastMove discs are on the
+        // board, where s == (solverCells+1-lastMove)/2 and lastMove has the
+        // parity of the winner's turns.
+        lastMove := solverCells + 1 - 2*s
+        if (lastMove-firstMove)%2 != 0 {
+                lastMove--
+        }
+        value.Winner = winner
+        value.MovesToWin = (lastMove-firstMove)/2 + 1
+        return value
+}
+
+// run executes a search with ctx as its deadline, lazily allocating the
+// transposition table.
+func (s *solverSearch) run(ctx context.Context, search func() int) (int, error) {
+        if s.table == nil {
+                s.table = newSolverTable()
+        }
+        s.ctx, s.nodes, s.stopped = ctx, 0, false
+        defer func() { s.ctx = nil }()
+
+        score := search()
+        if s.stopped {
+                return 0, errSolveStopped
+        }
+        return score, nil
+}
+
+func (s *solverSearch) solve(pos position, weak bool) int {
+        if pos.canWinNext() {
+                return (solverCells + 1 - pos.moves) / 2
+        }
+
+        min := -(solverCells - pos.moves) / 2
+        max := (solverCells + 1 - pos.moves) / 2
+        if weak {
+                min, max = -1, 1
+        }
+
+        // Narrow the window with null-window searches, probing near zero
+        // first because most positions are close to a draw.
+        for min < max && !s.stopped {
+                med := min + (max-min)/2
+                if med <= 0 && min/2 < med {
+                        med = min / 2
+                } else if med >= 0 && max/2 > med {
+                        med = max / 2
+                }
+                r := s.negamax(pos, med, med+1)
+                if r <= med {
+                        max = r
+                } else {
+                        min = r
+                }
+        }
+        return min
+}
+
+func (s *solverSearch) negamax(pos position, alpha, beta int) int {
+        s.nodes++
+        if s.nodes%checkInterval == 0 && s.ctx != nil && s.ctx.Err() != nil {
+                s.stopped = true
+        }
+        if s.stopped {
+                return alpha
+        }
+
+        possible := pos.possibleNonLosingMoves()
+        if possible == 0 {
+                return -(solverCells - pos.moves) / 2
+        }
+        if pos.moves >= solverCells-2 {
+                return 0
+        }
+
+        min := -(solverCells - 2 - pos.moves) / 2
+        if alpha < min {
+                alpha = min
+                if alpha >= beta {
+                        return alpha
+                }
+        }
+        max := (solverCells - 1 - pos.moves) / 2
+        if beta > max {
+                beta = max
+                if alpha >= beta {
+                        return beta
+                }
+        }
+
+        key := pos.key()
+        if value := int(s.table.get(key)); value != 0 {
+                if value > maxSolverScore-minSolverScore+1 {
+                        min = value + 2*minSolverScore - maxSolverScore - 2
+                        if alpha < min {
+                                alpha = min
+                                if alpha >= beta {
+                                        return alpha
+                                }
+                        }
+                } else {
+                        max = value + minSolverScore - 1
+                        if beta > max {
+                                beta = max
+                                if alpha >= beta {
+                                        return beta
+                                }
+                        }
+                }
+        }
+
+        if score, ok := s.book.lookup(&pos); ok {
+                return score
+        }
+
+        var moves moveSorter
+        for i := solverWidth - 1; i >= 0; i-- {
+                if move := possible & solverColumnMask(s.order[i]); move != 0 {
+                        moves.add(move, pos.moveScore(move))
+                }
+        }
+
+        for move := moves.next(); move != 0; move = moves.next() {
+                next := pos
+                next.play(move)
+                score := -s.negamax(next, -beta, -alpha)
+                if s.stopped {
+                        return alpha
+                }
+                if score >= beta {
+                        s.table.put(key, uint8(score+maxSolverScore-2*minSolverScore+2))
+                        return score
+                }
+                if score > alpha {
+                        alpha = score
+                }
+        }
+
+        s.table.put(key, uint8(alpha-minSolverScore+1))
+        return alpha
+}
+
+// moveSorter hands out moves highest score first; among equal scores the
+// one added last comes first.
+type moveSorter struct {
+        size    int
+        entries [solverWidth]struct {
+                move  uint64
+                score int
+        }
+}
+
+func (m *moveSorter) add(move uint64, score int) {
+        pos := m.size
+        m.size++
+        for ; pos > 0 && m.entries[pos-1].score > score; pos-- {
+                m.entries[pos] = m.entries[pos-1]
+        }
+        m.entries[pos].move = move
+        m.entries[pos].score = score
+}
+
+func (m *moveSorter) next() uint64 {
+        if m.size == 0 {
+                return 0
+        }
+        m.size--
+        return m.entries[m.size].move
+}
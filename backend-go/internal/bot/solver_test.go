@@ -0,0 +1,52 @@
+package bot
+
+import (
+        "context"
+        "fourinrow/internal/game"
+        "testing"
+        "time"
+)
+
+// TestSolverWaitRespectsDeadline checks that a call waiting for a busy
+// solver gives up at its deadline instead of queueing behind the search.
+func TestSolverWaitRespectsDeadline(t *testing.T) {
+        solver := NewSolver(DefaultOpeningBook())
+        busy, err := solver.acquire(context.Background())
+        if err != nil {
+                t.Fatal(err)
+        }
+
+        ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+        defer cancel()
+        board := game.CreateBoard()
+        start := time.Now()
+        if _, err := solver.Solve(ctx, &board); err != errSolveStopped {
+                t.Fatalf("Solve while the solver is busy: %v, want errSolveStopped", err)
+        }
+        if waited := time.Since(start); waited > time.Second {
+                t.Errorf("Solve waited %v for a busy solver", waited)
+        }
+
+        solver.release(busy)
+        if score, err := solver.Solve(context.Background(), &board); err != nil || score != firstMoveScores[3] {
+                t.Errorf("Solve once the solver is free = %d, %v, want %d", score, err, firstMoveScores[3])
+        }
+}
+
+// TestSolverRunsSearchesAtOnce checks that one search does not hold up
+// another while the solver has a search to spare.
+func TestSolverRunsSearchesAtOnce(t *testing.T) {
+        solver := newSolver(DefaultOpeningBook(), 2)
+        busy, err := solver.acquire(context.Background())
+        if err != nil {
+                t.Fatal(err)
+        }
+        defer solver.release(busy)
+
+        ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+        defer cancel()
+        board := game.CreateBoard()
+        if _, err := solver.Solve(ctx, &board); err != nil {
+                t.Errorf("Solve alongside another search: %v", err)
+        }
+}
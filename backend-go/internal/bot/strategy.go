@@ -0,0 +1,126 @@
+package bot
+
+import (
+        "context"
+        "fmt"
+        "fourinrow/internal/game"
+        "strings"
+        "sync"
+)
+
+// Strategy is an engine that plays as a bot. Name identifies it in the
+// registry and in GameState.Bot. SelectMove must return a legal move by
+// the time ctx is done.
+type Strategy interface {
+        Name() string
+        Description() string
+        SelectMove(ctx context.Context, board *game.Board, rules game.Rules, botPlayer game.Player) (game.MoveKind, int)
+}
+
+// Registry holds the strategies players can be matched against, by name.
+type Registry struct {
+        mu         sync.RWMutex
+        strategies map[string]Strategy
+        names      []string
+}
+
+func NewRegistry() *Registry {
+        return &Registry{strategies: make(map[string]Strategy)}
+}
+
+// Register adds a strategy, replacing any registered under the same name.
+func (r *Registry) Register(strategy Strategy) {
+        r.mu.Lock()
+        defer r.mu.Unlock()
+
+        name := strategy.Name()
+        if _, exists := r.strategies[name]; !exists {
+                r.names = append(r.names, name)
+        }
+        r.strategies[name] = strategy
+}
+
+func (r *Registry) Unregister(name string) {
+        r.mu.Lock()
+        defer r.mu.Unlock()
+
+        if _, exists := r.strategies[name]; !exists {
+                return
+        }
+        delete(r.strategies, name)
+        for i, registered := range r.names {
+                if registered == name {
+                        r.names = append(r.names[:i], r.names[i+1:]...)
+                        break
+                }
+        }
+}
+
+// Lookup finds a strategy by name, ignoring case.
+func (r *Registry) Lookup(name string) (Strategy, bool) {
+        r.mu.RLock()
+        defer r.mu.RUnlock()
+
+        if strategy, ok := r.strategies[name]; ok {
+                return strategy, true
+        }
+        for registered, strategy := range r.strategies {
+                if strings.EqualFold(registered, name) {
+                        return strategy, true
+                }
+        }
+        return nil, false
+}
+
+// List returns the strategies in the order they were first registered.
+func (r *Registry) List() []Strategy {
+        r.mu.RLock()
+        defer r.mu.RUnlock()
+
+        strategies := make([]Strategy, 0, len(r.names))
+        for _, name := range r.names {
+                strategies = append(strategies, r.strategies[name])
+        }
+        return strategies
+}
+
+// Bots is the registry the server matches players against. It starts out
+// with negamax at every difficulty and the MCTS bot.
+var Bots = NewRegistry()
+
+func init() {
+        for _, difficulty := range []Difficulty{Easy, Medium, Hard, Perfect} {
+                Bots.Register(difficulty)
+        }
+        Bots.Register(NewMCTS(DefaultPlayouts))
+}
+
+// ParseBot looks up the bot a player asked to face in Bots. An empty name
+// selects negamax at DefaultDifficulty.
+func ParseBot(name string) (Strategy, error) {
+        if name == "" {
+                return DefaultDifficulty, nil
+        }
+        strategy, ok := Bots.Lookup(name)
+        if !ok {
+                return nil, fmt.Errorf("unknown bot %q", name)
+        }
+        return strategy, nil
+}
+
+// DisplayName is the username a strategy plays under: its DisplayName
+// method if it has one, otherwise its name.
+func DisplayName(strategy Strategy) string {
+        if named, ok := strategy.(interface{ DisplayName() string }); ok {
+                return named.DisplayName()
+        }
+        return strategy.Name()
+}
+
+// OnLeaderboard reports whether games against a strategy count towards its
+// own stats, as they do for strategies with an OnLeaderboard method that
+// returns true. The built-in bots stay off the leaderboard.
+func OnLeaderboard(strategy Strategy) bool {
+        listed, ok := strategy.(interface{ OnLeaderboard() bool })
+        return ok && listed.OnLeaderboard()
+}
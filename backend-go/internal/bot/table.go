@@ -0,0 +1,102 @@
+package bot
+
+import (
+        "fourinrow/internal/game"
+        "math/rand"
+        "sync"
+)
+
+// zobristKeys holds a random key per player and bitboard bit; a position's
+// hash is the XOR of the keys of its discs, with zobristSide mixed in when
+// Player2 is to move.
+var (
+        zobristKeys [2][64]uint64
+        zobristSide uint64
+)
+
+func init() {
+        r := rand.New(rand.NewSource(0x4c0ffee))
+        for player := range zobristKeys {
+                for bit := range zobristKeys[player] {
+                        zobristKeys[player][bit] = r.Uint64()
+                }
+        }
+        zobristSide = r.Uint64()
+}
+
+func zobristHash(bb *game.Bitboard, toMove game.Player) uint64 {
+        var key uint64
+        for player, mask := range bb.Masks {
+                for bit := 0; bit < 64; bit++ {
+                        if mask&(1<<bit) != 0 {
+                                key ^= zobristKeys[player][bit]
+                        }
+                }
+        }
+        if toMove == game.Player2 {
+                key ^= zobristSide
+        }
+        return key
+}
+
+type boundFlag uint8
+
+const (
+        exactBound boundFlag = iota + 1
+        lowerBound
+        upperBound
+)
+
+type tableEntry struct {
+        key   uint64
+        score int32
+        depth int8
+        flag  boundFlag
+        move  int8
+}
+
+// tableSize is the number of entries in a transposition table, about 4MB.
+const tableSize = 1 << 18
+
+// transpositionTable caches search results by Zobrist key. Colliding
+// entries simply replace each other.
+type transpositionTable struct {
+        entries []tableEntry
+}
+
+// tablePool keeps transposition tables between searches, so that a bot
+// move does not allocate a fresh 4MB table every time.
+var tablePool = sync.Pool{
+        New: func() any {
+                return &transpositionTable{entries: make([]tableEntry, tableSize)}
+        },
+}
+
+// acquireTranspositionTable returns an empty table from the pool. Entries
+// left by an earlier search may be for another board size, so the table is
+// always cleared first.
+func acquireTranspositionTable() *transpositionTable {
+        t := tablePool.Get().(*transpositionTable)
+        clear(t.entries)
+        return t
+}
+
+// releaseTranspositionTable returns t to the pool; t must not be used after.
+func releaseTranspositionTable(t *transpositionTable) {
+        tablePool.Put(t)
+}
+
+func (t *transpositionTable) probe(key uint64) (tableEntry, bool) {
+        entry := t.entries[key&(tableSize-1)]
+        return entry, entry.flag != 0 && entry.key == key
+}
+
+func (t *transpositionTable) store(key uint64, depth, score int, flag boundFlag, move int) {
+        t.entries[key&(tableSize-1)] = tableEntry{
+                key:   key,
+                score: int32(score),
+                depth: int8(depth),
+                flag:  flag,
+                move:  int8(move),
+        }
+}
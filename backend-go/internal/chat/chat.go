@@ -0,0 +1,120 @@
+// Package chat holds the pieces of in-game chat that do not depend on the
+// WebSocket hub: message limits, quick reactions, rate limiting and word
+// filters.
+package chat
+
+import (
+        "errors"
+        "regexp"
+        "strings"
+        "sync"
+        "time"
+        "unicode/utf8"
+)
+
+// MaxLength is the longest chat message accepted, in characters.
+const MaxLength = 200
+
+// Each client may send RateBurst chat messages and reactions at once and
+// one more every RateInterval after that.
+const (
+        RateBurst    = 5
+        RateInterval = 2 * time.Second
+)
+
+// Reactions are the quick reactions players and spectators can send.
+var Reactions = []string{"👍", "👏", "😮", "😂", "😢", "🔥"}
+
+var (
+        ErrEmpty     = errors.New("message is empty")
+        ErrTooLong   = errors.New("message is too long")
+        ErrRateLimit = errors.New("you are sending messages too quickly")
+        ErrReaction  = errors.New("unknown reaction")
+)
+
+// Validate trims a chat message and checks its length.
+func Validate(text string) (string, error) {
+        text = strings.TrimSpace(text)
+        if text == "" {
+                return "", ErrEmpty
+        }
+        if utf8.RuneCountInString(text) > MaxLength {
+                return "", ErrTooLong
+        }
+        return text, nil
+}
+
+// IsReaction reports whether reaction is one of Reactions.
+func IsReaction(reaction string) bool {
+        for _, r := range Reactions {
+                if r == reaction {
+                        return true
+                }
+        }
+        return false
+}
+
+// Filter checks chat messages before they are delivered. It returns the
+// text to deliver, which may have been cleaned up, or an error saying why
+// the message was refused.
+type Filter interface {
+        Filter(text string) (string, error)
+}
+
+// BlockList is a Filter that replaces blocked words with asterisks. Words
+// are matched whole and ignoring case.
+type BlockList struct {
+        pattern *regexp.Regexp
+}
+
+// NewBlockList returns a BlockList for words. Empty words are ignored.
+func NewBlockList(words []string) *BlockList {
+        quoted := []string{}
+        for _, word := range words {
+                if word = strings.TrimSpace(word); word != "" {
+                        quoted = append(quoted, regexp.QuoteMeta(word))
+                }
+        }
+        if len(quoted) == 0 {
+                return &BlockList{}
+        }
+        return &BlockList{pattern: regexp.MustCompile(`(?i)\b(` + strings.Join(quoted, "|") + `)\b`)}
+}
+
+func (b *BlockList) Filter(text string) (string, error) {
+        if b.pattern == nil {
+                return text, nil
+        }
+        return b.pattern.ReplaceAllStringFunc(text, func(word string) string {
+                return strings.Repeat("*", utf8.RuneCountInString(word))
+        }), nil
+}
+
+// Limiter is a token bucket allowing RateBurst messages at once and one
+// more every RateInterval.
+type Limiter struct {
+        mu     sync.Mutex
+        tokens float64
+        last   time.Time
+}
+
+// Allow reports whether a message sent at now is within the limit, and
+// counts it if so.
+func (l *Limiter) Allow(now time.Time) bool {
+        l.mu.Lock()
+        defer l.mu.Unlock()
+
+        if l.last.IsZero() {
+                l.tokens = RateBurst
+        } else {
+                l.tokens += float64(now.Sub(l.last)) / float64(RateInterval)
+                l.tokens = min(l.tokens, RateBurst)
+        }
+        l.last = now
+
+        if l.tokens < 1 {
+                return false
+        }
+        l.tokens--
+        return true
+}
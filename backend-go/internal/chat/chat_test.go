@@ -0,0 +1,96 @@
+package chat
+
+import (
+        "testing"
+        "time"
+)
+
+func TestLimiterAllow(t *testing.T) {
+        start := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+        tests := []struct {
+                name  string
+                after time.Duration
+                want  bool
+        }{
+                // The bucket starts full: a burst of RateBurst goes through.
+                {"burst 1", 0, true},
+                {"burst 2", 0, true},
+                {"burst 3", 0, true},
+                {"burst 4", 0, true},
+                {"burst 5", 0, true},
+                {"over the burst", 0, false},
+                {"half a token later", RateInterval / 2, false},
+                {"one token later", RateInterval, true},
+                {"token already spent", RateInterval, false},
+                {"two more tokens", 3 * RateInterval, true},
+                {"second of the two", 3 * RateInterval, true},
+                {"both spent", 3 * RateInterval, false},
+                // A long pause refills the bucket to RateBurst, no more.
+                {"after a pause 1", time.Hour, true},
+                {"after a pause 2", time.Hour, true},
+                {"after a pause 3", time.Hour, true},
+                {"after a pause 4", time.Hour, true},
+                {"after a pause 5", time.Hour, true},
+                {"refill is capped", time.Hour, false},
+        }
+
+        var limiter Limiter
+        for _, tt := range tests {
+                if got := limiter.Allow(start.Add(tt.after)); got != tt.want {
+                        t.Errorf("%s: Allow at +%v = %v, want %v", tt.name, tt.after, got, tt.want)
+                }
+        }
+}
+
+func TestBlockListFilter(t *testing.T) {
+        filter := NewBlockList([]string{"darn", " heck ", "", "a.b"})
+        tests := []struct {
+                in   string
+                want string
+        }{
+                {"well darn it", "well **** it"},
+                {"DARN", "****"},
+                {"Darn, heck!", "****, ****!"},
+                {"darning the socks", "darning the socks"},
+                {"undarn", "undarn"},
+                {"what the heck-fire", "what the ****-fire"},
+                {"a.b and axb", "*** and axb"},
+                {"nothing to see", "nothing to see"},
+        }
+        for _, tt := range tests {
+                got, err := filter.Filter(tt.in)
+                if err != nil {
+                        t.Errorf("Filter(%q): %v", tt.in, err)
+                        continue
+                }
+                if got != tt.want {
+                        t.Errorf("Filter(%q) = %q, want %q", tt.in, got, tt.want)
+                }
+        }
+}
+
+func TestEmptyBlockList(t *testing.T) {
+        filter := NewBlockList([]string{"", "  "})
+        if got, err := filter.Filter("anything goes"); err != nil || got != "anything goes" {
+                t.Errorf("Filter with no words = %q, %v", got, err)
+        }
+}
+
+func TestValidate(t *testing.T) {
+        if got, err := Validate("  hello  "); err != nil || got != "hello" {
+                t.Errorf("Validate trims to %q, %v", got, err)
+        }
+        if _, err := Validate("   "); err != ErrEmpty {
+                t.Errorf("Validate of blank message: %v, want ErrEmpty", err)
+        }
+        long := make([]rune, MaxLength+1)
+        for i := range long {
+                long[i] = 'é'
+        }
+        if _, err := Validate(string(long[:MaxLength])); err != nil {
+                t.Errorf("Validate of %d characters: %v", MaxLength, err)
+        }
+        if _, err := Validate(string(long)); err != ErrTooLong {
+                t.Errorf("Validate of %d characters: %v, want ErrTooLong", MaxLength+1, err)
+        }
+}
@@ -2,22 +2,47 @@ package database
 
 import (
         "database/sql"
+        "encoding/json"
+        "errors"
+        "fmt"
         "fourinrow/internal/game"
+        "fourinrow/internal/rating"
         "log"
         "os"
+        "sort"
+        "time"
 
         _ "github.com/lib/pq"
 )
 
+var ErrGameNotFound = errors.New("game not found")
+
+// Leaderboard orderings accepted by GetLeaderboard.
+const (
+        SortByRating = "rating"
+        SortByWins   = "wins"
+)
+
 type DB struct {
         conn *sql.DB
 }
 
 type PlayerStats struct {
-        Username  string `json:"username"`
-        Wins      int    `json:"wins"`
-        Losses    int    `json:"losses"`
-        Draws     int    `json:"draws"`
+        Username        string  `json:"username"`
+        Wins            int     `json:"wins"`
+        Losses          int     `json:"losses"`
+        Draws           int     `json:"draws"`
+        Rating          float64 `json:"rating"`
+        RatingDeviation float64 `json:"ratingDeviation"`
+}
+
+// RatingChange is a player's rating after a rated game.
+type RatingChange struct {
+        GameID    string    `json:"gameId"`
+        Opponent  string    `json:"opponent"`
+        Change    float64   `json:"change"`
+        rating.Rating
+        CreatedAt time.Time `json:"createdAt"`
 }
 
 func NewDB() (*DB, error) {
@@ -65,6 +90,39 @@ func (db *DB) Initialize() error {
                 created_at TIMESTAMP DEFAULT NOW()
         );`
 
+        migrateGamesTable := `
+        ALTER TABLE games
+                ADD COLUMN IF NOT EXISTS started_at TIMESTAMP,
+                ADD COLUMN IF NOT EXISTS finished_at TIMESTAMP,
+                ADD COLUMN IF NOT EXISTS board_rows INTEGER DEFAULT 6,
+                ADD COLUMN IF NOT EXISTS board_cols INTEGER DEFAULT 7,
+                ADD COLUMN IF NOT EXISTS win_length INTEGER DEFAULT 4,
+                ADD COLUMN IF NOT EXISTS pop_out BOOLEAN DEFAULT FALSE,
+                ADD COLUMN IF NOT EXISTS winning_line TEXT,
+                ADD COLUMN IF NOT EXISTS previous_game_id VARCHAR(255),
+                ADD COLUMN IF NOT EXISTS result_reason VARCHAR(32),
+                ADD COLUMN IF NOT EXISTS chat_data TEXT;`
+
+        migratePlayersTable := `
+        ALTER TABLE players
+                ADD COLUMN IF NOT EXISTS rating DOUBLE PRECISION DEFAULT 1500,
+                ADD COLUMN IF NOT EXISTS rating_deviation DOUBLE PRECISION DEFAULT 350,
+                ADD COLUMN IF NOT EXISTS volatility DOUBLE PRECISION DEFAULT 0.06;`
+
+        createRatingHistoryTable := `
+        CREATE TABLE IF NOT EXISTS rating_history (
+                id SERIAL PRIMARY KEY,
+                username VARCHAR(255) NOT NULL,
+                game_id VARCHAR(255) NOT NULL,
+                opponent VARCHAR(255),
+                rating DOUBLE PRECISION NOT NULL,
+                rating_deviation DOUBLE PRECISION NOT NULL,
+                volatility DOUBLE PRECISION NOT NULL,
+                rating_change DOUBLE PRECISION NOT NULL,
+                created_at TIMESTAMP DEFAULT NOW()
+        );
+        CREATE INDEX IF NOT EXISTS rating_history_username ON rating_history (username, created_at);`
+
         if _, err := db.conn.Exec(createPlayersTable); err != nil {
                 return err
         }
@@ -73,63 +131,256 @@ func (db *DB) Initialize() error {
                 return err
         }
 
+        if _, err := db.conn.Exec(migrateGamesTable); err != nil {
+                return err
+        }
+
+        if _, err := db.conn.Exec(migratePlayersTable); err != nil {
+                return err
+        }
+
+        if _, err := db.conn.Exec(createRatingHistoryTable); err != nil {
+                return err
+        }
+
         log.Println("✅ Database tables initialized")
         return nil
 }
 
+// SaveGame records a finished game, the players' win/loss/draw counts and,
+// for rated games, their new ratings, all in one transaction.
 func (db *DB) SaveGame(gameState *game.GameState) error {
         if db.conn == nil {
                 return nil
         }
 
-        _, err := db.conn.Exec(
-                `INSERT INTO games (game_id, player1, player2, winner) 
-                 VALUES ($1, $2, $3, $4)`,
-                gameState.ID, gameState.Player1, gameState.Player2, gameState.Winner,
+        movesData, err := game.EncodeMoves(gameState.Moves)
+        if err != nil {
+                return err
+        }
+
+        winningLine, err := json.Marshal(gameState.WinningLine)
+        if err != nil {
+                return err
+        }
+
+        var chatData string
+        if len(gameState.Chat) > 0 {
+                data, err := json.Marshal(gameState.Chat)
+                if err != nil {
+                        return err
+                }
+                chatData = string(data)
+        }
+
+        tx, err := db.conn.Begin()
+        if err != nil {
+                return err
+        }
+        defer tx.Rollback()
+
+        _, err = tx.Exec(
+                `INSERT INTO games (game_id, player1, player2, winner, moves_data, started_at, finished_at, board_rows, board_cols, win_length, pop_out, winning_line, previous_game_id, result_reason, chat_data) 
+                 VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13, $14, $15)`,
+                gameState.ID, gameState.Player1, gameState.Player2, gameState.Winner, movesData,
+                nullTime(gameState.CreatedAt), nullTime(gameState.FinishedAt),
+                gameState.Rules.Rows, gameState.Rules.Cols, gameState.Rules.WinLength, gameState.Rules.PopOut,
+                string(winningLine), nullString(gameState.PreviousGameID), nullString(gameState.Reason),
+                nullString(chatData),
         )
 
         if err != nil {
                 return err
         }
 
-        if gameState.Winner == "Draw" {
-                if err := db.updatePlayerStats(gameState.Player1, 0, 0, 1); err != nil {
-                        log.Printf("Failed to update player stats for %s: %v", gameState.Player1, err)
+        var score1 float64
+        switch gameState.Winner {
+        case "Draw":
+                score1 = 0.5
+        case gameState.Player1:
+                score1 = 1
+        case gameState.Player2:
+                score1 = 0
+        default:
+                return tx.Commit()
+        }
+
+        // Built-in bots are left off the leaderboard.
+        recordPlayer2 := gameState.Bot == "" || gameState.BotOnLeaderboard
+
+        results := []playerResult{{gameState.Player1, score1}}
+        if recordPlayer2 {
+                results = append(results, playerResult{gameState.Player2, 1 - score1})
+        }
+        // Lock the players' rows in a fixed order so that concurrent saves
+        // cannot deadlock.
+        sort.Slice(results, func(i, j int) bool { return results[i].username < results[j].username })
+        for _, result := range results {
+                if err := updatePlayerStats(tx, result.username, result.score); err != nil {
+                        return fmt.Errorf("updating stats for %s: %w", result.username, err)
                 }
-                if gameState.Player2 != "AI Bot" {
-                        if err := db.updatePlayerStats(gameState.Player2, 0, 0, 1); err != nil {
-                                log.Printf("Failed to update player stats for %s: %v", gameState.Player2, err)
-                        }
+        }
+
+        if gameState.Rated {
+                if err := updateRatings(tx, gameState, score1); err != nil {
+                        return fmt.Errorf("updating ratings: %w", err)
                 }
-        } else if gameState.Winner == gameState.Player1 {
-                if err := db.updatePlayerStats(gameState.Player1, 1, 0, 0); err != nil {
-                        log.Printf("Failed to update player stats for %s: %v", gameState.Player1, err)
+        }
+
+        return tx.Commit()
+}
+
+type playerResult struct {
+        username string
+        score    float64
+}
+
+// updateRatings applies a rated game to both players' ratings. A bot plays
+// at the fixed rating in gameState.BotRating and its own rating is left
+// alone.
+func updateRatings(tx *sql.Tx, gameState *game.GameState, score1 float64) error {
+        before1, err := loadRating(tx, gameState.Player1)
+        if err != nil {
+                return err
+        }
+
+        before2 := rating.Fixed(gameState.BotRating)
+        if gameState.Bot == "" {
+                before2, err = loadRating(tx, gameState.Player2)
+                if err != nil {
+                        return err
                 }
-                if gameState.Player2 != "AI Bot" {
-                        if err := db.updatePlayerStats(gameState.Player2, 0, 1, 0); err != nil {
-                                log.Printf("Failed to update player stats for %s: %v", gameState.Player2, err)
-                        }
+        }
+
+        if err := saveRating(tx, gameState.ID, gameState.Player1, gameState.Player2, before1, rating.Update(before1, before2, score1)); err != nil {
+                return err
+        }
+        if gameState.Bot == "" {
+                if err := saveRating(tx, gameState.ID, gameState.Player2, gameState.Player1, before2, rating.Update(before2, before1, 1-score1)); err != nil {
+                        return err
                 }
-        } else if gameState.Winner == gameState.Player2 {
-                if gameState.Player2 != "AI Bot" {
-                        if err := db.updatePlayerStats(gameState.Player2, 1, 0, 0); err != nil {
-                                log.Printf("Failed to update player stats for %s: %v", gameState.Player2, err)
-                        }
+        }
+        return nil
+}
+
+func loadRating(tx *sql.Tx, username string) (rating.Rating, error) {
+        var r rating.Rating
+        err := tx.QueryRow(
+                `SELECT rating, rating_deviation, volatility FROM players WHERE username = $1 FOR UPDATE`,
+                username,
+        ).Scan(&r.Rating, &r.Deviation, &r.Volatility)
+        return r, err
+}
+
+func saveRating(tx *sql.Tx, gameID, username, opponent string, before, after rating.Rating) error {
+        _, err := tx.Exec(
+                `UPDATE players SET rating = $2, rating_deviation = $3, volatility = $4 WHERE username = $1`,
+                username, after.Rating, after.Deviation, after.Volatility,
+        )
+        if err != nil {
+                return err
+        }
+
+        _, err = tx.Exec(
+                `INSERT INTO rating_history (username, game_id, opponent, rating, rating_deviation, volatility, rating_change)
+                 VALUES ($1, $2, $3, $4, $5, $6, $7)`,
+                username, gameID, opponent, after.Rating, after.Deviation, after.Volatility, after.Rating-before.Rating,
+        )
+        return err
+}
+
+func (db *DB) GetGame(gameID string) (*game.GameState, error) {
+        if db.conn == nil {
+                return nil, ErrGameNotFound
+        }
+
+        var (
+                gameState   game.GameState
+                winner      sql.NullString
+                movesData   sql.NullString
+                createdAt   time.Time
+                startedAt   sql.NullTime
+                finishedAt  sql.NullTime
+                winningLine sql.NullString
+                previousID  sql.NullString
+                reason      sql.NullString
+                chatData    sql.NullString
+        )
+        err := db.conn.QueryRow(
+                `SELECT game_id, player1, player2, winner, moves_data, created_at, started_at, finished_at,
+                        COALESCE(board_rows, 6), COALESCE(board_cols, 7), COALESCE(win_length, 4), COALESCE(pop_out, FALSE), winning_line, previous_game_id, result_reason, chat_data
+                 FROM games
+                 WHERE game_id = $1`,
+                gameID,
+        ).Scan(&gameState.ID, &gameState.Player1, &gameState.Player2, &winner, &movesData, &createdAt, &startedAt, &finishedAt,
+                &gameState.Rules.Rows, &gameState.Rules.Cols, &gameState.Rules.WinLength, &gameState.Rules.PopOut, &winningLine, &previousID, &reason, &chatData)
+        if err == sql.ErrNoRows {
+                return nil, ErrGameNotFound
+        }
+        if err != nil {
+                return nil, err
+        }
+
+        moves, err := game.DecodeMoves(movesData.String)
+        if err != nil {
+                return nil, err
+        }
+        board, err := game.ReplayMoves(gameState.Rules, moves, len(moves))
+        if err != nil {
+                return nil, err
+        }
+
+        if winningLine.Valid && winningLine.String != "" {
+                if err := json.Unmarshal([]byte(winningLine.String), &gameState.WinningLine); err != nil {
+                        return nil, err
                 }
-                if err := db.updatePlayerStats(gameState.Player1, 0, 1, 0); err != nil {
-                        log.Printf("Failed to update player stats for %s: %v", gameState.Player1, err)
+        }
+
+        if chatData.Valid && chatData.String != "" {
+                if err := json.Unmarshal([]byte(chatData.String), &gameState.Chat); err != nil {
+                        return nil, err
                 }
         }
 
-        return nil
+        gameState.Winner = winner.String
+        gameState.PreviousGameID = previousID.String
+        gameState.Reason = reason.String
+        gameState.Moves = moves
+        gameState.Board = board
+        gameState.IsFinished = true
+        gameState.CreatedAt = createdAt.UTC()
+        if startedAt.Valid {
+                gameState.CreatedAt = startedAt.Time.UTC()
+        }
+        if finishedAt.Valid {
+                gameState.FinishedAt = finishedAt.Time.UTC()
+        }
+
+        return &gameState, nil
 }
 
-func (db *DB) updatePlayerStats(username string, wins, losses, draws int) error {
-        if db.conn == nil {
-                return nil
+func nullTime(t time.Time) sql.NullTime {
+        return sql.NullTime{Time: t, Valid: !t.IsZero()}
+}
+
+func nullString(s string) sql.NullString {
+        return sql.NullString{String: s, Valid: s != ""}
+}
+
+// updatePlayerStats adds a game with the given score (1, 0.5 or 0) to a
+// player's record.
+func updatePlayerStats(tx *sql.Tx, username string, score float64) error {
+        wins, losses, draws := 0, 0, 0
+        switch score {
+        case 1:
+                wins = 1
+        case 0:
+                losses = 1
+        default:
+                draws = 1
         }
 
-        _, err := db.conn.Exec(
+        _, err := tx.Exec(
                 `INSERT INTO players (username, wins, losses, draws)
                  VALUES ($1, $2, $3, $4)
                  ON CONFLICT (username) 
@@ -143,15 +394,31 @@ func (db *DB) updatePlayerStats(username string, wins, losses, draws int) error
         return err
 }
 
-func (db *DB) GetLeaderboard(limit int) ([]PlayerStats, error) {
+// GetLeaderboard returns the top players ordered by SortByRating or
+// SortByWins.
+func (db *DB) GetLeaderboard(limit int, sortBy string) ([]PlayerStats, error) {
         if db.conn == nil {
                 return []PlayerStats{}, nil
         }
 
+        var where, orderBy string
+        switch sortBy {
+        case SortByRating:
+                // Players without a rated game still have the starting
+                // rating, which says nothing about how well they play.
+                where = "WHERE EXISTS (SELECT 1 FROM rating_history h WHERE h.username = players.username)"
+                orderBy = "rating DESC, rating_deviation, wins DESC"
+        case SortByWins:
+                orderBy = "wins DESC, rating DESC"
+        default:
+                return nil, fmt.Errorf("unknown leaderboard order %q", sortBy)
+        }
+
         rows, err := db.conn.Query(
-                `SELECT username, wins, losses, draws 
+                `SELECT username, wins, losses, draws, COALESCE(rating, 1500), COALESCE(rating_deviation, 350) 
                  FROM players 
-                 ORDER BY wins DESC 
+                 `+where+` 
+                 ORDER BY `+orderBy+` 
                  LIMIT $1`,
                 limit,
         )
@@ -163,13 +430,63 @@ func (db *DB) GetLeaderboard(limit int) ([]PlayerStats, error) {
         stats := []PlayerStats{}
         for rows.Next() {
                 var s PlayerStats
-                if err := rows.Scan(&s.Username, &s.Wins, &s.Losses, &s.Draws); err != nil {
+                if err := rows.Scan(&s.Username, &s.Wins, &s.Losses, &s.Draws, &s.Rating, &s.RatingDeviation); err != nil {
                         return nil, err
                 }
                 stats = append(stats, s)
         }
 
-        return stats, nil
+        return stats, rows.Err()
+}
+
+// GetRating returns a player's current rating, or rating.DefaultRating for
+// someone who has not played yet.
+func (db *DB) GetRating(username string) (float64, error) {
+        if db.conn == nil {
+                return rating.DefaultRating, nil
+        }
+
+        playerRating := rating.DefaultRating
+        err := db.conn.QueryRow(
+                `SELECT COALESCE(rating, 1500) FROM players WHERE username = $1`,
+                username,
+        ).Scan(&playerRating)
+        if err == sql.ErrNoRows {
+                return rating.DefaultRating, nil
+        }
+        return playerRating, err
+}
+
+// GetRatingHistory returns a player's ratings after each of their rated
+// games, oldest first.
+func (db *DB) GetRatingHistory(username string) ([]RatingChange, error) {
+        if db.conn == nil {
+                return []RatingChange{}, nil
+        }
+
+        rows, err := db.conn.Query(
+                `SELECT game_id, COALESCE(opponent, ''), rating, rating_deviation, volatility, rating_change, created_at
+                 FROM rating_history
+                 WHERE username = $1
+                 ORDER BY created_at, id`,
+                username,
+        )
+        if err != nil {
+                return nil, err
+        }
+        defer rows.Close()
+
+        history := []RatingChange{}
+        for rows.Next() {
+                var c RatingChange
+                if err := rows.Scan(&c.GameID, &c.Opponent, &c.Rating.Rating, &c.Deviation, &c.Volatility, &c.Change, &c.CreatedAt); err != nil {
+                        return nil, err
+                }
+                c.CreatedAt = c.CreatedAt.UTC()
+                history = append(history, c)
+        }
+
+        return history, rows.Err()
 }
 
 func (db *DB) Close() error {
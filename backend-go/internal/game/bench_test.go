@@ -0,0 +1,57 @@
+package game
+
+import "testing"
+
+// benchmarkBoard plays a drawn-out standard opening with no line on the
+// board, so that win detection has to look at every cell.
+func benchmarkBoard(b *testing.B) Board {
+        board := CreateBoard()
+        player := Player1
+        for _, col := range []int{3, 3, 2, 4, 4, 2, 5, 1, 1, 0, 6, 6, 0, 5, 2, 3} {
+                if _, err := MakeMove(&board, col, player); err != nil {
+                        b.Fatal(err)
+                }
+                player = player.Opponent()
+        }
+        if winner, _ := checkWinnerScan(&board, DefaultRules()); winner != Empty {
+                b.Fatalf("benchmark board already won by %d", winner)
+        }
+        return board
+}
+
+// BenchmarkCheckWinner measures the per-move check the hub runs, which goes
+// through a Bitboard for standard boards.
+func BenchmarkCheckWinner(b *testing.B) {
+        board := benchmarkBoard(b)
+        rules := DefaultRules()
+        b.ResetTimer()
+        for i := 0; i < b.N; i++ {
+                CheckWinner(&board, rules)
+        }
+}
+
+// BenchmarkCheckWinnerScan measures the array scan CheckWinner used before
+// bitboards, still used for boards too large for one.
+func BenchmarkCheckWinnerScan(b *testing.B) {
+        board := benchmarkBoard(b)
+        rules := DefaultRules()
+        b.ResetTimer()
+        for i := 0; i < b.N; i++ {
+                checkWinnerScan(&board, rules)
+        }
+}
+
+// BenchmarkBitboardHasWon measures win detection on an already converted
+// Bitboard, as search code uses it.
+func BenchmarkBitboardHasWon(b *testing.B) {
+        board := benchmarkBoard(b)
+        bb, err := BitboardFromBoard(board, DefaultRules())
+        if err != nil {
+                b.Fatal(err)
+        }
+        b.ResetTimer()
+        for i := 0; i < b.N; i++ {
+                bb.HasWon(Player1)
+                bb.HasWon(Player2)
+        }
+}
@@ -0,0 +1,194 @@
+package game
+
+import (
+        "errors"
+        "math/bits"
+)
+
+// MaxBitboardCols is the widest board a Bitboard can hold.
+const MaxBitboardCols = 16
+
+// Bitboard is a compact form of Board used for win detection and search.
+// Each column takes Rows+1 bits, bottom cell first, so bit col*(Rows+1)+row
+// is set in Masks[p-1] when player p has a disc there (row 0 is the bottom
+// here, unlike Board). The spare bit on top of every column is always clear,
+// which stops lines from wrapping from one column into the next.
+type Bitboard struct {
+        Masks   [2]uint64
+        Heights [MaxBitboardCols]uint8
+
+        rows      int
+        cols      int
+        winLength int
+}
+
+var errBitboardTooLarge = errors.New("board does not fit in a bitboard")
+
+// BitboardFits reports whether boards with these rules can be represented as
+// a Bitboard.
+func BitboardFits(rules Rules) bool {
+        return rules.Cols <= MaxBitboardCols && (rules.Rows+1)*rules.Cols <= 64
+}
+
+func NewBitboard(rules Rules) (Bitboard, error) {
+        if !BitboardFits(rules) {
+                return Bitboard{}, errBitboardTooLarge
+        }
+        return Bitboard{rows: rules.Rows, cols: rules.Cols, winLength: rules.WinLength}, nil
+}
+
+// BitboardFromBoard converts a board into its bitboard form. Discs are
+// expected to rest on each other as MakeMove and PopMove leave them.
+func BitboardFromBoard(board Board, rules Rules) (Bitboard, error) {
+        bb, err := NewBitboard(Rules{Rows: board.Rows(), Cols: board.Cols(), WinLength: rules.WinLength})
+        if err != nil {
+                return Bitboard{}, err
+        }
+
+        height := uint(bb.rows + 1)
+        for row := bb.rows - 1; row >= 0; row-- {
+                cells := board[row]
+                shift := uint(bb.rows - 1 - row)
+                for col, player := range cells {
+                        if player != Empty {
+                                bb.Masks[player-1] |= 1 << (uint(col)*height + shift)
+                                bb.Heights[col]++
+                        }
+                }
+        }
+        return bb, nil
+}
+
+func (b *Bitboard) ToBoard() Board {
+        board := NewBoard(Rules{Rows: b.rows, Cols: b.cols, WinLength: b.winLength})
+        for col := 0; col < b.cols; col++ {
+                for height := 0; height < int(b.Heights[col]); height++ {
+                        row := b.rows - 1 - height
+                        if b.Masks[0]&b.bit(col, height) != 0 {
+                                board[row][col] = Player1
+                        } else {
+                                board[row][col] = Player2
+                        }
+                }
+        }
+        return board
+}
+
+func (b *Bitboard) Cols() int {
+        return b.cols
+}
+
+func (b *Bitboard) CanPlay(col int) bool {
+        return col >= 0 && col < b.cols && int(b.Heights[col]) < b.rows
+}
+
+// Play drops a disc for player into col and returns the Board row it landed
+// in. The caller must check CanPlay first.
+func (b *Bitboard) Play(col int, player Player) int {
+        height := int(b.Heights[col])
+        b.Masks[player-1] |= b.bit(col, height)
+        b.Heights[col]++
+        return b.rows - 1 - height
+}
+
+// Undo takes the top disc back out of col.
+func (b *Bitboard) Undo(col int) {
+        b.Heights[col]--
+        keep := ^b.bit(col, int(b.Heights[col]))
+        b.Masks[0] &= keep
+        b.Masks[1] &= keep
+}
+
+func (b *Bitboard) ValidColumns() []int {
+        valid := []int{}
+        for col := 0; col < b.cols; col++ {
+                if b.CanPlay(col) {
+                        valid = append(valid, col)
+                }
+        }
+        return valid
+}
+
+func (b *Bitboard) IsFull() bool {
+        for col := 0; col < b.cols; col++ {
+                if int(b.Heights[col]) < b.rows {
+                        return false
+                }
+        }
+        return true
+}
+
+// MoveCount is the number of discs on the board.
+func (b *Bitboard) MoveCount() int {
+        return bits.OnesCount64(b.Masks[0] | b.Masks[1])
+}
+
+func (b *Bitboard) HasWon(player Player) bool {
+        mask := b.Masks[player-1]
+        height := uint(b.rows + 1)
+        if b.winLength == WinLength {
+                for _, shift := range [4]uint{1, height, height + 1, height - 1} {
+                        m := mask & (mask >> shift)
+                        if m&(m>>(2*shift)) != 0 {
+                                return true
+                        }
+                }
+                return false
+        }
+
+        for _, shift := range [4]uint{1, height, height + 1, height - 1} {
+                if lineStarts(mask, shift, b.winLength) != 0 {
+                        return true
+                }
+        }
+        return false
+}
+
+// lineStarts returns the bits of mask from which winLength discs in a row
+// follow in the direction of shift. Runs are doubled in length at each step
+// rather than extended one disc at a time.
+func lineStarts(mask uint64, shift uint, winLength int) uint64 {
+        m := mask
+        run := 1
+        for run*2 <= winLength {
+                m &= m >> (uint(run) * shift)
+                run *= 2
+        }
+        if run < winLength {
+                m &= m >> (uint(winLength-run) * shift)
+        }
+        return m
+}
+
+func (b *Bitboard) bit(col, height int) uint64 {
+        return 1 << (col*(b.rows+1) + height)
+}
+
+// BitboardWindows returns a mask for every straight run of WinLength cells
+// on a board with these rules, in the bit layout of Bitboard.
+func BitboardWindows(rules Rules) []uint64 {
+        b, err := NewBitboard(rules)
+        if err != nil {
+                return nil
+        }
+
+        windows := []uint64{}
+        directions := [4][2]int{{1, 0}, {0, 1}, {1, 1}, {1, -1}}
+        for col := 0; col < b.cols; col++ {
+                for height := 0; height < b.rows; height++ {
+                        for _, d := range directions {
+                                endCol := col + d[0]*(b.winLength-1)
+                                endHeight := height + d[1]*(b.winLength-1)
+                                if endCol >= b.cols || endHeight < 0 || endHeight >= b.rows {
+                                        continue
+                                }
+                                var window uint64
+                                for i := 0; i < b.winLength; i++ {
+                                        window |= b.bit(col+d[0]*i, height+d[1]*i)
+                                }
+                                windows = append(windows, window)
+                        }
+                }
+        }
+        return windows
+}
@@ -0,0 +1,147 @@
+package game
+
+import (
+        "math/rand"
+        "testing"
+)
+
+// bitboardRules are the boards the bitboard is checked on: every variant
+// that fits one, and odd shapes and line lengths that none of them use.
+var bitboardRules = []Rules{
+        {Rows: 6, Cols: 7, WinLength: 4},
+        {Rows: 7, Cols: 8, WinLength: 4},
+        {Rows: 6, Cols: 9, WinLength: 5},
+        {Rows: 4, Cols: 4, WinLength: 4},
+        {Rows: 5, Cols: 10, WinLength: 4},
+        {Rows: 3, Cols: 16, WinLength: 3},
+        {Rows: 7, Cols: 7, WinLength: 6},
+        {Rows: 6, Cols: 6, WinLength: 2},
+}
+
+// scanHasWon reports whether player has a line on board, using the array
+// scan on a copy of the board holding only player's discs.
+func scanHasWon(board Board, rules Rules, player Player) bool {
+        own := NewBoard(Rules{Rows: board.Rows(), Cols: board.Cols()})
+        for row := range board {
+                for col, cell := range board[row] {
+                        if cell == player {
+                                own[row][col] = player
+                        }
+                }
+        }
+        winner, _ := checkWinnerScan(&own, rules)
+        return winner == player
+}
+
+// checkAgainstScan fails t if the bitboard and the scan disagree about
+// either player on board.
+func checkAgainstScan(t *testing.T, board Board, rules Rules, what string) {
+        t.Helper()
+        bb, err := BitboardFromBoard(board, rules)
+        if err != nil {
+                t.Fatalf("%v: %v", rules, err)
+        }
+        for _, player := range []Player{Player1, Player2} {
+                if got, want := bb.HasWon(player), scanHasWon(board, rules, player); got != want {
+                        t.Fatalf("%v, %s: HasWon(%d) = %v, scan says %v\n%v", rules, what, player, got, want, board)
+                }
+        }
+}
+
+// TestBitboardEveryLine places each possible line on an empty board, and
+// the same line one disc short, in all four directions.
+func TestBitboardEveryLine(t *testing.T) {
+        directions := [4][2]int{{0, 1}, {1, 0}, {1, 1}, {1, -1}}
+        for _, rules := range bitboardRules {
+                for row := 0; row < rules.Rows; row++ {
+                        for col := 0; col < rules.Cols; col++ {
+                                for _, d := range directions {
+                                        endRow := row + d[0]*(rules.WinLength-1)
+                                        endCol := col + d[1]*(rules.WinLength-1)
+                                        if endRow >= rules.Rows || endCol < 0 || endCol >= rules.Cols {
+                                                continue
+                                        }
+                                        for _, length := range []int{rules.WinLength, rules.WinLength - 1} {
+                                                board := NewBoard(rules)
+                                                for i := 0; i < length; i++ {
+                                                        board[row+d[0]*i][col+d[1]*i] = Player2
+                                                }
+                                                checkAgainstScan(t, board, rules, "single line")
+
+                                                bb, _ := BitboardFromBoard(board, rules)
+                                                if got := bb.HasWon(Player2); got != (length == rules.WinLength) {
+                                                        t.Fatalf("%v: line of %d from (%d,%d) in direction %v: HasWon = %v", rules, length, row, col, d, got)
+                                                }
+                                        }
+                                }
+                        }
+                }
+        }
+}
+
+// TestBitboardNoWrap puts discs at the edges of neighbouring columns, where
+// a bitboard without the spare bit on top of each column would see a line.
+func TestBitboardNoWrap(t *testing.T) {
+        for _, rules := range bitboardRules {
+                half := rules.WinLength / 2
+                for col := 0; col+1 < rules.Cols; col++ {
+                        board := NewBoard(rules)
+                        // The top of col and the bottom of col+1 are next to
+                        // each other in the bit layout, one spare bit apart.
+                        for i := 0; i < half && i < rules.Rows; i++ {
+                                board[i][col] = Player1
+                        }
+                        for i := 0; i < rules.WinLength-half && i < rules.Rows; i++ {
+                                board[rules.Rows-1-i][col+1] = Player1
+                        }
+                        checkAgainstScan(t, board, rules, "column edges")
+                }
+        }
+}
+
+// TestBitboardRandomBoards fills boards at random, ignoring gravity, which
+// win detection does not depend on.
+func TestBitboardRandomBoards(t *testing.T) {
+        r := rand.New(rand.NewSource(1))
+        for _, rules := range bitboardRules {
+                for n := 0; n < 2000; n++ {
+                        board := NewBoard(rules)
+                        density := r.Float64()
+                        for row := range board {
+                                for col := range board[row] {
+                                        if r.Float64() < density {
+                                                board[row][col] = Player(1 + r.Intn(2))
+                                        }
+                                }
+                        }
+                        checkAgainstScan(t, board, rules, "random board")
+                }
+        }
+}
+
+// TestCheckWinnerRandomGames plays random games to the end and compares
+// CheckWinner with the scan after every move, as the hub calls it.
+func TestCheckWinnerRandomGames(t *testing.T) {
+        r := rand.New(rand.NewSource(2))
+        for _, rules := range bitboardRules {
+                for n := 0; n < 300; n++ {
+                        board := NewBoard(rules)
+                        player := Player1
+                        for {
+                                columns := GetValidColumns(&board)
+                                if _, err := MakeMove(&board, columns[r.Intn(len(columns))], player); err != nil {
+                                        t.Fatal(err)
+                                }
+                                winner, isDraw := CheckWinner(&board, rules)
+                                scanWinner, scanDraw := checkWinnerScan(&board, rules)
+                                if winner != scanWinner || isDraw != scanDraw {
+                                        t.Fatalf("%v: CheckWinner = %d, %v; scan = %d, %v\n%v", rules, winner, isDraw, scanWinner, scanDraw, board)
+                                }
+                                if winner != Empty || isDraw {
+                                        break
+                                }
+                                player = player.Opponent()
+                        }
+                }
+        }
+}
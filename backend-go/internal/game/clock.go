@@ -0,0 +1,114 @@
+package game
+
+import (
+        "fmt"
+        "strings"
+        "time"
+)
+
+// TimeControl limits how long players may think. With PerMove set every
+// move must be made within PerMove. Otherwise each player has Initial for
+// the whole game, and Increment is added to their clock after each of their
+// moves. The zero TimeControl has no clock.
+//
+// Time controls are written "30s" for a limit per move and "3m+2s" for an
+// initial time plus increment; "none" is the zero value.
+type TimeControl struct {
+        PerMove   time.Duration
+        Initial   time.Duration
+        Increment time.Duration
+}
+
+// ParseTimeControl reads a time control in the form described on
+// TimeControl.
+func ParseTimeControl(s string) (TimeControl, error) {
+        if s == "" || s == "none" {
+                return TimeControl{}, nil
+        }
+
+        initial, increment, hasIncrement := strings.Cut(s, "+")
+        first, err := time.ParseDuration(initial)
+        if err != nil || first <= 0 {
+                return TimeControl{}, fmt.Errorf("invalid time control %q", s)
+        }
+        if !hasIncrement {
+                return TimeControl{PerMove: first}, nil
+        }
+        inc, err := time.ParseDuration(increment)
+        if err != nil || inc < 0 {
+                return TimeControl{}, fmt.Errorf("invalid time control %q", s)
+        }
+        return TimeControl{Initial: first, Increment: inc}, nil
+}
+
+// Enabled reports whether the time control has a clock at all.
+func (tc TimeControl) Enabled() bool {
+        return tc.PerMove > 0 || tc.Initial > 0
+}
+
+func (tc TimeControl) String() string {
+        switch {
+        case tc.PerMove > 0:
+                return tc.PerMove.String()
+        case tc.Initial > 0:
+                return tc.Initial.String() + "+" + tc.Increment.String()
+        }
+        return "none"
+}
+
+func (tc TimeControl) MarshalText() ([]byte, error) {
+        return []byte(tc.String()), nil
+}
+
+func (tc *TimeControl) UnmarshalText(text []byte) error {
+        parsed, err := ParseTimeControl(string(text))
+        if err != nil {
+                return err
+        }
+        *tc = parsed
+        return nil
+}
+
+// StartClock gives both players their starting time and starts the clock
+// of the player to move.
+func (g *GameState) StartClock(now time.Time) {
+        start := g.TimeControl.PerMove
+        if start == 0 {
+                start = g.TimeControl.Initial
+        }
+        g.Clocks = [2]time.Duration{start, start}
+        g.TurnStartedAt = now
+}
+
+// TimeLeft is how much time player has at now, counting down while it is
+// their turn.
+func (g *GameState) TimeLeft(player Player, now time.Time) time.Duration {
+        left := g.Clocks[player-1]
+        if player == g.CurrentTurn {
+                left -= now.Sub(g.TurnStartedAt)
+        }
+        return left
+}
+
+// PunchClock stops player's clock after their move at now and starts the
+// opponent's. It must be called before CurrentTurn passes to the opponent.
+func (g *GameState) PunchClock(player Player, now time.Time) {
+        if !g.TimeControl.Enabled() {
+                return
+        }
+        if g.TimeControl.PerMove > 0 {
+                g.Clocks[player-1] = g.TimeControl.PerMove
+        } else {
+                g.Clocks[player-1] = g.TimeLeft(player, now) + g.TimeControl.Increment
+        }
+        g.TurnStartedAt = now
+}
+
+// ClockMillis reports both players' remaining time in milliseconds, for
+// sending to clients.
+func (g *GameState) ClockMillis(now time.Time) map[string]int64 {
+        return map[string]int64{
+                "player1": max(g.TimeLeft(Player1, now), 0).Milliseconds(),
+                "player2": max(g.TimeLeft(Player2, now), 0).Milliseconds(),
+        }
+}
@@ -0,0 +1,125 @@
+package game
+
+import (
+        "testing"
+        "time"
+)
+
+func TestParseTimeControl(t *testing.T) {
+        tests := []struct {
+                in      string
+                want    TimeControl
+                wantErr bool
+        }{
+                {in: "", want: TimeControl{}},
+                {in: "none", want: TimeControl{}},
+                {in: "30s", want: TimeControl{PerMove: 30 * time.Second}},
+                {in: "1m30s", want: TimeControl{PerMove: 90 * time.Second}},
+                {in: "3m+2s", want: TimeControl{Initial: 3 * time.Minute, Increment: 2 * time.Second}},
+                {in: "5m+0s", want: TimeControl{Initial: 5 * time.Minute}},
+                {in: "30", wantErr: true},
+                {in: "fast", wantErr: true},
+                {in: "0s", wantErr: true},
+                {in: "-30s", wantErr: true},
+                {in: "3m+", wantErr: true},
+                {in: "3m+-2s", wantErr: true},
+                {in: "+2s", wantErr: true},
+        }
+        for _, tt := range tests {
+                got, err := ParseTimeControl(tt.in)
+                if tt.wantErr {
+                        if err == nil {
+                                t.Errorf("ParseTimeControl(%q) = %+v, want an error", tt.in, got)
+                        }
+                        continue
+                }
+                if err != nil {
+                        t.Errorf("ParseTimeControl(%q): %v", tt.in, err)
+                        continue
+                }
+                if got != tt.want {
+                        t.Errorf("ParseTimeControl(%q) = %+v, want %+v", tt.in, got, tt.want)
+                }
+                if tt.want.Enabled() {
+                        if again, err := ParseTimeControl(got.String()); err != nil || again != got {
+                                t.Errorf("ParseTimeControl(%q) does not round-trip: %+v, %v", got.String(), again, err)
+                        }
+                }
+        }
+}
+
+func TestTimeControlDefaultIsOff(t *testing.T) {
+        var tc TimeControl
+        if tc.Enabled() {
+                t.Error("the zero TimeControl has a clock")
+        }
+        if tc.String() != "none" {
+                t.Errorf("zero TimeControl is written %q, want \"none\"", tc.String())
+        }
+}
+
+func TestClockPerMove(t *testing.T) {
+        start := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+        g := &GameState{CurrentTurn: Player1, TimeControl: TimeControl{PerMove: 30 * time.Second}}
+        g.StartClock(start)
+
+        if left := g.TimeLeft(Player1, start.Add(10*time.Second)); left != 20*time.Second {
+                t.Errorf("player 1 has %v after 10s, want 20s", left)
+        }
+        if left := g.TimeLeft(Player2, start.Add(10*time.Second)); left != 30*time.Second {
+                t.Errorf("player 2 has %v while waiting, want 30s", left)
+        }
+
+        // Every move starts the next one with the full limit, however long
+        // it took.
+        g.PunchClock(Player1, start.Add(25*time.Second))
+        g.CurrentTurn = Player2
+        if left := g.TimeLeft(Player1, start.Add(40*time.Second)); left != 30*time.Second {
+                t.Errorf("player 1 has %v after moving, want 30s", left)
+        }
+        if left := g.TimeLeft(Player2, start.Add(40*time.Second)); left != 15*time.Second {
+                t.Errorf("player 2 has %v after 15s, want 15s", left)
+        }
+        if left := g.TimeLeft(Player2, start.Add(60*time.Second)); left != -5*time.Second {
+                t.Errorf("player 2 has %v after 35s, want -5s", left)
+        }
+}
+
+func TestClockIncrement(t *testing.T) {
+        start := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+        g := &GameState{CurrentTurn: Player1, TimeControl: TimeControl{Initial: time.Minute, Increment: 2 * time.Second}}
+        g.StartClock(start)
+
+        now := start.Add(10 * time.Second)
+        g.PunchClock(Player1, now)
+        g.CurrentTurn = Player2
+        if left := g.TimeLeft(Player1, now); left != 52*time.Second {
+                t.Errorf("player 1 has %v after a 10s move, want 52s", left)
+        }
+
+        now = now.Add(5 * time.Second)
+        g.PunchClock(Player2, now)
+        g.CurrentTurn = Player1
+        if left := g.TimeLeft(Player2, now); left != 57*time.Second {
+                t.Errorf("player 2 has %v after a 5s move, want 57s", left)
+        }
+
+        // Player 1's clock runs from where it stopped.
+        if left := g.TimeLeft(Player1, now.Add(50*time.Second)); left != 2*time.Second {
+                t.Errorf("player 1 has %v after thinking 50s more, want 2s", left)
+        }
+        millis := g.ClockMillis(now.Add(time.Minute))
+        if millis["player1"] != 0 || millis["player2"] != 57000 {
+                t.Errorf("ClockMillis = %v, want player1 0 and player2 57000", millis)
+        }
+}
+
+func TestPunchClockWithoutTimeControl(t *testing.T) {
+        start := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+        g := &GameState{CurrentTurn: Player1}
+        g.StartClock(start)
+        g.PunchClock(Player1, start.Add(time.Hour))
+        if g.Clocks != [2]time.Duration{} || !g.TurnStartedAt.Equal(start) {
+                t.Errorf("PunchClock changed a game without a clock: %v, %v", g.Clocks, g.TurnStartedAt)
+        }
+}
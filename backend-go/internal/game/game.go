@@ -2,6 +2,8 @@ package game
 
 import (
         "errors"
+        "fmt"
+        "time"
 )
 
 const (
@@ -18,37 +20,206 @@ const (
         Player2 Player = 2
 )
 
-type Board [Rows][Cols]Player
+func (p Player) Opponent() Player {
+        if p == Player1 {
+                return Player2
+        }
+        return Player1
+}
+
+type MoveKind string
+
+const (
+        MoveDrop MoveKind = "drop"
+        MovePop  MoveKind = "pop"
+)
+
+// Rules describes the board a game is played on and how many discs in a
+// line win it.
+type Rules struct {
+        Rows      int `json:"rows"`
+        Cols      int `json:"cols"`
+        WinLength int `json:"winLength"`
+        // PopOut lets a player remove one of their own discs from the bottom
+        // row instead of dropping a new one.
+        PopOut bool `json:"popOut,omitempty"`
+}
+
+var Variants = map[string]Rules{
+        "standard": {Rows: 6, Cols: 7, WinLength: 4},
+        "8x7":      {Rows: 7, Cols: 8, WinLength: 4},
+        "9x7":      {Rows: 7, Cols: 9, WinLength: 4},
+        "connect5": {Rows: 6, Cols: 9, WinLength: 5},
+        "popout":   {Rows: 6, Cols: 7, WinLength: 4, PopOut: true},
+}
+
+func DefaultRules() Rules {
+        return Rules{Rows: Rows, Cols: Cols, WinLength: WinLength}
+}
+
+// ParseVariant returns the rules for a named variant. An empty name selects
+// the standard 7x6 connect four board.
+func ParseVariant(name string) (Rules, error) {
+        if name == "" {
+                return DefaultRules(), nil
+        }
+        rules, ok := Variants[name]
+        if !ok {
+                return Rules{}, fmt.Errorf("unknown variant %q", name)
+        }
+        return rules, nil
+}
+
+// Board holds the cells row by row, with row 0 at the top. Its dimensions
+// are those of the Rules it was created with.
+type Board [][]Player
+
+// Reasons a game can end, stored in GameState.Reason.
+const (
+        ReasonConnectFour = "connect_four"
+        ReasonBoardFull   = "board_full"
+        ReasonRepetition  = "repetition"
+        ReasonResignation = "resignation"
+        ReasonAgreement   = "agreement"
+        ReasonDisconnect  = "disconnect"
+        ReasonTimeout     = "timeout"
+        // ReasonIllegalMove ends a game whose bot answered with a move the
+        // rules do not allow.
+        ReasonIllegalMove = "illegal_move"
+)
 
 type Move struct {
-        Column int    `json:"column"`
-        Row    int    `json:"row"`
-        Player Player `json:"player"`
+        Ply       int       `json:"ply"`
+        Kind      MoveKind  `json:"kind,omitempty"`
+        Column    int       `json:"column"`
+        Row       int       `json:"row"`
+        Player    Player    `json:"player"`
+        Username  string    `json:"username,omitempty"`
+        Timestamp time.Time `json:"timestamp,omitzero"`
+}
+
+// ChatLine is one message of a game's chat transcript.
+type ChatLine struct {
+        From      string    `json:"from"`
+        Text      string    `json:"text"`
+        Spectator bool      `json:"spectator,omitempty"`
+        Timestamp time.Time `json:"timestamp"`
 }
 
 type GameState struct {
         ID         string `json:"id"`
         Player1    string `json:"player1"`
         Player2    string `json:"player2"`
+        // Bot is the registered name of the bot strategy playing as
+        // Player2, empty in games between two people.
+        Bot        string `json:"bot,omitempty"`
+        // BotOnLeaderboard records the bot's results under its name like a
+        // person's.
+        BotOnLeaderboard bool `json:"-"`
+        // Rated is set for games between two people from the public queue
+        // and games against bots with a fixed rating. They change the
+        // players' ratings; see HintsAllowed.
+        Rated      bool   `json:"rated,omitempty"`
+        // BotRating is the fixed rating the bot plays at in a rated game.
+        BotRating  float64 `json:"-"`
+        // PreviousGameID is the game this one is a rematch of.
+        PreviousGameID string `json:"previousGameId,omitempty"`
+        Rules      Rules  `json:"rules"`
         Board      Board  `json:"board"`
         CurrentTurn Player `json:"currentTurn"`
+        TimeControl TimeControl `json:"timeControl,omitzero"`
+        // Clocks holds each player's remaining time as of TurnStartedAt,
+        // when the player to move started thinking.
+        Clocks        [2]time.Duration `json:"-"`
+        TurnStartedAt time.Time        `json:"-"`
         Winner     string `json:"winner,omitempty"`
+        // Reason is how the game ended, one of the Reason constants.
+        Reason     string `json:"reason,omitempty"`
+        // DrawOffer is the player whose draw offer is waiting for an
+        // answer, if any.
+        DrawOffer  Player `json:"drawOffer,omitempty"`
         IsFinished bool   `json:"isFinished"`
+        WinningLine []Cell   `json:"winningLine,omitempty"`
+        Moves      []Move    `json:"moves"`
+        // Chat is the game's chat transcript, kept only when the server
+        // stores transcripts. It is left out of the game's JSON so that a
+        // game in progress does not publish it; see the games API.
+        Chat       []ChatLine `json:"-"`
+        CreatedAt  time.Time `json:"createdAt"`
+        FinishedAt time.Time `json:"finishedAt,omitzero"`
+}
+
+// HintsAllowed reports whether the players may ask for hints and analysis
+// while the game is in progress. Only rated games between two people
+// forbid them; against a bot, rated or not, a player is only practising.
+func (g *GameState) HintsAllowed() bool {
+        return !g.Rated || g.Bot != ""
+}
+
+// Clone returns a copy of the game that shares nothing with it, to read or
+// save while the game carries on. The caller must hold the game's lock.
+func (g *GameState) Clone() *GameState {
+        clone := *g
+        clone.Board = g.Board.Clone()
+        clone.WinningLine = append([]Cell(nil), g.WinningLine...)
+        clone.Moves = append(make([]Move, 0, len(g.Moves)), g.Moves...)
+        clone.Chat = append([]ChatLine(nil), g.Chat...)
+        return &clone
+}
+
+// RecordMove stamps an applied move with its ply number, the username that
+// played it and the server time, and appends it to the game's history.
+func (g *GameState) RecordMove(move *Move, username string) {
+        if move.Kind == "" {
+                move.Kind = MoveDrop
+        }
+        move.Ply = len(g.Moves) + 1
+        move.Username = username
+        move.Timestamp = time.Now().UTC()
+        g.Moves = append(g.Moves, *move)
 }
 
 func CreateBoard() Board {
-        return Board{}
+        return NewBoard(DefaultRules())
+}
+
+func NewBoard(rules Rules) Board {
+        board := make(Board, rules.Rows)
+        for row := range board {
+                board[row] = make([]Player, rules.Cols)
+        }
+        return board
+}
+
+func (b Board) Rows() int {
+        return len(b)
+}
+
+func (b Board) Cols() int {
+        if len(b) == 0 {
+                return 0
+        }
+        return len(b[0])
+}
+
+func (b Board) Clone() Board {
+        clone := make(Board, len(b))
+        for row := range b {
+                clone[row] = append([]Player(nil), b[row]...)
+        }
+        return clone
 }
 
 func MakeMove(board *Board, column int, player Player) (*Move, error) {
-        if column < 0 || column >= Cols {
+        if column < 0 || column >= board.Cols() {
                 return nil, errors.New("invalid column")
         }
 
-        for row := Rows - 1; row >= 0; row-- {
-                if board[row][column] == Empty {
-                        board[row][column] = player
+        for row := board.Rows() - 1; row >= 0; row-- {
+                if (*board)[row][column] == Empty {
+                        (*board)[row][column] = player
                         return &Move{
+                                Kind:   MoveDrop,
                                 Column: column,
                                 Row:    row,
                                 Player: player,
@@ -59,14 +230,72 @@ func MakeMove(board *Board, column int, player Player) (*Move, error) {
         return nil, errors.New("column is full")
 }
 
-func CheckWinner(board *Board) (Player, bool) {
-        for row := 0; row < Rows; row++ {
-                for col := 0; col <= Cols-WinLength; col++ {
-                        player := board[row][col]
+// ApplyMove plays a move of the given kind for player. Pops are only
+// accepted when the rules allow them.
+func ApplyMove(board *Board, rules Rules, kind MoveKind, column int, player Player) (*Move, error) {
+        switch kind {
+        case MoveDrop, "":
+                return MakeMove(board, column, player)
+        case MovePop:
+                if !rules.PopOut {
+                        return nil, errors.New("popping is only allowed in PopOut games")
+                }
+                return PopMove(board, column, player)
+        }
+        return nil, fmt.Errorf("unknown move kind %q", kind)
+}
+
+// ResolveWinner is CheckWinner for the position right after mover played.
+// In PopOut a pop can complete lines for both players at once, in which case
+// the player who popped wins, and a full board is only a draw when the next
+// player has nothing to pop.
+func ResolveWinner(board *Board, rules Rules, mover Player) (Player, bool) {
+        if !rules.PopOut {
+                return CheckWinner(board, rules)
+        }
+
+        moverWins := hasLine(*board, rules.WinLength, mover)
+        opponentWins := hasLine(*board, rules.WinLength, mover.Opponent())
+        if moverWins {
+                return mover, false
+        }
+        if opponentWins {
+                return mover.Opponent(), false
+        }
+
+        if len(GetValidColumns(board)) == 0 && len(GetValidPops(board, mover.Opponent())) == 0 {
+                return Empty, true
+        }
+        return Empty, false
+}
+
+func CheckWinner(board *Board, rules Rules) (Player, bool) {
+        bb, err := BitboardFromBoard(*board, rules)
+        if err != nil {
+                return checkWinnerScan(board, rules)
+        }
+
+        if bb.HasWon(Player1) {
+                return Player1, false
+        }
+        if bb.HasWon(Player2) {
+                return Player2, false
+        }
+        return Empty, bb.IsFull()
+}
+
+// checkWinnerScan is CheckWinner for boards too large for a Bitboard.
+func checkWinnerScan(board *Board, rules Rules) (Player, bool) {
+        b := *board
+        rows, cols, winLength := b.Rows(), b.Cols(), rules.WinLength
+
+        for row := 0; row < rows; row++ {
+                for col := 0; col <= cols-winLength; col++ {
+                        player := b[row][col]
                         if player != Empty {
                                 win := true
-                                for i := 1; i < WinLength; i++ {
-                                        if board[row][col+i] != player {
+                                for i := 1; i < winLength; i++ {
+                                        if b[row][col+i] != player {
                                                 win = false
                                                 break
                                         }
@@ -78,13 +307,13 @@ func CheckWinner(board *Board) (Player, bool) {
                 }
         }
 
-        for col := 0; col < Cols; col++ {
-                for row := 0; row <= Rows-WinLength; row++ {
-                        player := board[row][col]
+        for col := 0; col < cols; col++ {
+                for row := 0; row <= rows-winLength; row++ {
+                        player := b[row][col]
                         if player != Empty {
                                 win := true
-                                for i := 1; i < WinLength; i++ {
-                                        if board[row+i][col] != player {
+                                for i := 1; i < winLength; i++ {
+                                        if b[row+i][col] != player {
                                                 win = false
                                                 break
                                         }
@@ -96,13 +325,13 @@ func CheckWinner(board *Board) (Player, bool) {
                 }
         }
 
-        for row := 0; row <= Rows-WinLength; row++ {
-                for col := 0; col <= Cols-WinLength; col++ {
-                        player := board[row][col]
+        for row := 0; row <= rows-winLength; row++ {
+                for col := 0; col <= cols-winLength; col++ {
+                        player := b[row][col]
                         if player != Empty {
                                 win := true
-                                for i := 1; i < WinLength; i++ {
-                                        if board[row+i][col+i] != player {
+                                for i := 1; i < winLength; i++ {
+                                        if b[row+i][col+i] != player {
                                                 win = false
                                                 break
                                         }
@@ -114,13 +343,13 @@ func CheckWinner(board *Board) (Player, bool) {
                 }
         }
 
-        for row := 0; row <= Rows-WinLength; row++ {
-                for col := WinLength - 1; col < Cols; col++ {
-                        player := board[row][col]
+        for row := 0; row <= rows-winLength; row++ {
+                for col := winLength - 1; col < cols; col++ {
+                        player := b[row][col]
                         if player != Empty {
                                 win := true
-                                for i := 1; i < WinLength; i++ {
-                                        if board[row+i][col-i] != player {
+                                for i := 1; i < winLength; i++ {
+                                        if b[row+i][col-i] != player {
                                                 win = false
                                                 break
                                         }
@@ -133,8 +362,8 @@ func CheckWinner(board *Board) (Player, bool) {
         }
 
         isFull := true
-        for col := 0; col < Cols; col++ {
-                if board[0][col] == Empty {
+        for col := 0; col < cols; col++ {
+                if b[0][col] == Empty {
                         isFull = false
                         break
                 }
@@ -148,18 +377,64 @@ func CheckWinner(board *Board) (Player, bool) {
 }
 
 func IsValidMove(board *Board, column int) bool {
-        if column < 0 || column >= Cols {
+        if column < 0 || column >= board.Cols() {
                 return false
         }
-        return board[0][column] == Empty
+        return (*board)[0][column] == Empty
 }
 
 func GetValidColumns(board *Board) []int {
         valid := []int{}
-        for col := 0; col < Cols; col++ {
-                if board[0][col] == Empty {
+        for col := 0; col < board.Cols(); col++ {
+                if (*board)[0][col] == Empty {
                         valid = append(valid, col)
                 }
         }
         return valid
 }
+
+// ValidateBoard checks that a board received from outside has the size the
+// rules call for, holds only known players and has no disc resting on an
+// empty cell.
+func ValidateBoard(board Board, rules Rules) error {
+        if board.Rows() != rules.Rows {
+                return fmt.Errorf("board has %d rows, expected %d", board.Rows(), rules.Rows)
+        }
+        for row := range board {
+                if len(board[row]) != rules.Cols {
+                        return fmt.Errorf("board row %d has %d columns, expected %d", row, len(board[row]), rules.Cols)
+                }
+                for col, cell := range board[row] {
+                        if cell != Empty && cell != Player1 && cell != Player2 {
+                                return fmt.Errorf("invalid cell %d at row %d, column %d", cell, row, col)
+                        }
+                        if cell != Empty && row+1 < board.Rows() && board[row+1][col] == Empty {
+                                return fmt.Errorf("disc at row %d, column %d is floating", row, col)
+                        }
+                }
+        }
+        return nil
+}
+
+// NextPlayer works out whose turn it is in a game without pops from the
+// number of discs each player has on the board.
+func NextPlayer(board *Board) (Player, error) {
+        difference := 0
+        for _, row := range *board {
+                for _, cell := range row {
+                        switch cell {
+                        case Player1:
+                                difference++
+                        case Player2:
+                                difference--
+                        }
+                }
+        }
+        switch difference {
+        case 0:
+                return Player1, nil
+        case 1:
+                return Player2, nil
+        }
+        return Empty, errors.New("impossible disc counts")
+}
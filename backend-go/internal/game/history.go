@@ -0,0 +1,81 @@
+package game
+
+import (
+        "encoding/json"
+        "fmt"
+)
+
+// MovesDataVersion is the version written by EncodeMoves.
+//
+// Version 1 of the moves_data encoding is a JSON object holding the version
+// and the ordered move list:
+//
+//      {
+//        "version": 1,
+//        "moves": [
+//          {"ply": 1, "kind": "drop", "column": 3, "row": 5, "player": 1, "username": "alice", "timestamp": "2024-01-02T15:04:05.123Z"},
+//          {"ply": 2, "kind": "drop", "column": 3, "row": 4, "player": 2, "username": "AI Bot", "timestamp": "2024-01-02T15:04:06.456Z"}
+//        ]
+//      }
+//
+// Plies start at 1 and are contiguous, "row" is counted from the top of the
+// board as in Board, and timestamps are RFC 3339 in UTC taken by the server
+// when the move was applied. "kind" is "drop" or "pop"; a missing kind means
+// drop, and pops record the bottom row. Decoders must reject versions they
+// do not know.
+const MovesDataVersion = 1
+
+type movesData struct {
+        Version int    `json:"version"`
+        Moves   []Move `json:"moves"`
+}
+
+func EncodeMoves(moves []Move) (string, error) {
+        if moves == nil {
+                moves = []Move{}
+        }
+        data, err := json.Marshal(movesData{Version: MovesDataVersion, Moves: moves})
+        if err != nil {
+                return "", err
+        }
+        return string(data), nil
+}
+
+func DecodeMoves(data string) ([]Move, error) {
+        if data == "" {
+                return []Move{}, nil
+        }
+
+        var decoded movesData
+        if err := json.Unmarshal([]byte(data), &decoded); err != nil {
+                return nil, err
+        }
+        if decoded.Version != MovesDataVersion {
+                return nil, fmt.Errorf("unsupported moves_data version %d", decoded.Version)
+        }
+        if decoded.Moves == nil {
+                decoded.Moves = []Move{}
+        }
+        return decoded.Moves, nil
+}
+
+// ReplayMoves rebuilds the board as it stood after the given ply by applying
+// the recorded moves to an empty board. Ply 0 is the empty board.
+func ReplayMoves(rules Rules, moves []Move, ply int) (Board, error) {
+        if ply < 0 || ply > len(moves) {
+                return nil, fmt.Errorf("ply %d out of range 0-%d", ply, len(moves))
+        }
+
+        board := NewBoard(rules)
+        for i := 0; i < ply; i++ {
+                recorded := moves[i]
+                move, err := ApplyMove(&board, rules, recorded.Kind, recorded.Column, recorded.Player)
+                if err != nil {
+                        return nil, fmt.Errorf("ply %d: %w", i+1, err)
+                }
+                if move.Row != recorded.Row {
+                        return nil, fmt.Errorf("ply %d: recorded row %d does not match replayed row %d", i+1, recorded.Row, move.Row)
+                }
+        }
+        return board, nil
+}
@@ -0,0 +1,58 @@
+package game
+
+// Cell is a board position, with row 0 at the top as in Board.
+type Cell struct {
+        Row    int `json:"row"`
+        Column int `json:"column"`
+}
+
+// WinningCells returns every cell that is part of a completed line of
+// player's discs, ordered top to bottom and left to right. A move that
+// completes several lines at once reports all of their cells.
+func WinningCells(board *Board, rules Rules, player Player) []Cell {
+        b := *board
+        rows, cols, winLength := b.Rows(), b.Cols(), rules.WinLength
+        directions := [4][2]int{{0, 1}, {1, 0}, {1, 1}, {1, -1}}
+
+        inLine := make([][]bool, rows)
+        for row := range inLine {
+                inLine[row] = make([]bool, cols)
+        }
+
+        for row := 0; row < rows; row++ {
+                for col := 0; col < cols; col++ {
+                        if b[row][col] != player {
+                                continue
+                        }
+                        for _, d := range directions {
+                                endRow := row + d[0]*(winLength-1)
+                                endCol := col + d[1]*(winLength-1)
+                                if endRow < 0 || endRow >= rows || endCol < 0 || endCol >= cols {
+                                        continue
+                                }
+                                line := true
+                                for i := 1; i < winLength; i++ {
+                                        if b[row+d[0]*i][col+d[1]*i] != player {
+                                                line = false
+                                                break
+                                        }
+                                }
+                                if line {
+                                        for i := 0; i < winLength; i++ {
+                                                inLine[row+d[0]*i][col+d[1]*i] = true
+                                        }
+                                }
+                        }
+                }
+        }
+
+        cells := []Cell{}
+        for row := 0; row < rows; row++ {
+                for col := 0; col < cols; col++ {
+                        if inLine[row][col] {
+                                cells = append(cells, Cell{Row: row, Column: col})
+                        }
+                }
+        }
+        return cells
+}
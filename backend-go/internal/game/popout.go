@@ -0,0 +1,132 @@
+package game
+
+import (
+        "errors"
+        "strings"
+)
+
+// RepetitionLimit is how many times the same position may occur in a PopOut
+// game, with the same player to move, before the game is drawn.
+const RepetitionLimit = 3
+
+// PopMove removes player's disc from the bottom of column and shifts the
+// rest of the column down by one row.
+func PopMove(board *Board, column int, player Player) (*Move, error) {
+        if column < 0 || column >= board.Cols() {
+                return nil, errors.New("invalid column")
+        }
+        if !IsValidPop(board, column, player) {
+                return nil, errors.New("you can only pop your own disc from the bottom row")
+        }
+
+        b := *board
+        bottom := b.Rows() - 1
+        for row := bottom; row > 0; row-- {
+                b[row][column] = b[row-1][column]
+        }
+        b[0][column] = Empty
+
+        return &Move{
+                Kind:   MovePop,
+                Column: column,
+                Row:    bottom,
+                Player: player,
+        }, nil
+}
+
+func IsValidPop(board *Board, column int, player Player) bool {
+        if column < 0 || column >= board.Cols() {
+                return false
+        }
+        return (*board)[board.Rows()-1][column] == player
+}
+
+func GetValidPops(board *Board, player Player) []int {
+        valid := []int{}
+        for col := 0; col < board.Cols(); col++ {
+                if IsValidPop(board, col, player) {
+                        valid = append(valid, col)
+                }
+        }
+        return valid
+}
+
+// Outcome reports the winner, or a draw, once mover's move has been applied
+// to the board and recorded, along with the Reason the game ended. PopOut
+// games are also drawn when a position repeats RepetitionLimit times.
+func (g *GameState) Outcome(mover Player) (Player, bool, string) {
+        winner, isDraw := ResolveWinner(&g.Board, g.Rules, mover)
+        switch {
+        case winner != Empty:
+                return winner, false, ReasonConnectFour
+        case isDraw:
+                return Empty, true, ReasonBoardFull
+        case g.Rules.PopOut && RepetitionCount(g.Rules, g.Moves) >= RepetitionLimit:
+                return Empty, true, ReasonRepetition
+        }
+        return Empty, false, ""
+}
+
+// RepetitionCount replays moves and reports how many times the final
+// position, including the player to move, occurred during the game.
+func RepetitionCount(rules Rules, moves []Move) int {
+        board := NewBoard(rules)
+        seen := map[string]int{positionKey(board, Player1): 1}
+
+        key := positionKey(board, Player1)
+        for _, move := range moves {
+                if _, err := ApplyMove(&board, rules, move.Kind, move.Column, move.Player); err != nil {
+                        return 0
+                }
+                key = positionKey(board, move.Player.Opponent())
+                seen[key]++
+        }
+        return seen[key]
+}
+
+func positionKey(board Board, toMove Player) string {
+        var key strings.Builder
+        key.Grow(board.Rows()*board.Cols() + 1)
+        key.WriteByte(byte('0' + toMove))
+        for _, row := range board {
+                for _, cell := range row {
+                        key.WriteByte(byte('0' + cell))
+                }
+        }
+        return key.String()
+}
+
+func hasLine(board Board, winLength int, player Player) bool {
+        if bb, err := BitboardFromBoard(board, Rules{WinLength: winLength}); err == nil {
+                return bb.HasWon(player)
+        }
+
+        directions := [4][2]int{{0, 1}, {1, 0}, {1, 1}, {1, -1}}
+        rows, cols := board.Rows(), board.Cols()
+
+        for row := 0; row < rows; row++ {
+                for col := 0; col < cols; col++ {
+                        if board[row][col] != player {
+                                continue
+                        }
+                        for _, d := range directions {
+                                endRow := row + d[0]*(winLength-1)
+                                endCol := col + d[1]*(winLength-1)
+                                if endRow < 0 || endRow >= rows || endCol < 0 || endCol >= cols {
+                                        continue
+                                }
+                                line := true
+                                for i := 1; i < winLength; i++ {
+                                        if board[row+d[0]*i][col+d[1]*i] != player {
+                                                line = false
+                                                break
+                                        }
+                                }
+                                if line {
+                                        return true
+                                }
+                        }
+                }
+        }
+        return false
+}
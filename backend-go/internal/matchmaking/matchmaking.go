@@ -3,7 +3,10 @@ package matchmaking
 import (
         "fourinrow/internal/bot"
         "fourinrow/internal/game"
+        "fourinrow/internal/rating"
         "log"
+        "math"
+        "math/rand"
         "sync"
         "time"
 
@@ -15,36 +18,98 @@ type ClientConnection struct {
         Username     string
         GameID       string
         PlayerNumber game.Player
+        Rules        game.Rules
+        TimeControl  game.TimeControl
+        // Bot is the engine to play against if no opponent turns up. When
+        // nil a connected remote bot is preferred, then the default
+        // difficulty.
+        Bot          bot.Strategy
+        // Rating is the player's rating when they joined the queue, and
+        // JoinedAt when they joined it.
+        Rating       float64
+        JoinedAt     time.Time
 }
 
+// matchRetryInterval is how often a waiting player's widening rating
+// window is checked for new opponents.
+const matchRetryInterval = time.Second
+
 type Matchmaker struct {
         mu                   sync.RWMutex
         waitingPlayers       []*ClientConnection
         games                map[string]*game.GameState
+        gameLocks            map[string]*sync.Mutex
         playerToGame         map[string]string
         reconnectionTimeout  time.Duration
         matchmakingTimeout   time.Duration
-        onGameCreated        func(*game.GameState)
+        onGameCreated        func(*game.GameState, []*ClientConnection)
+        remoteBots           []bot.Strategy
+        botRatings           map[string]float64
+        ratingWindow         RatingWindow
+        loadRating           func(username string) (float64, error)
+        waitStats            map[int]*waitStats
+        rooms                map[string]*Room
+        onRoomExpired        func(*Room)
+        rematchOffers        map[string]*rematchOffer
 }
 
 func NewMatchmaker(matchmakingTimeout, reconnectionTimeout time.Duration) *Matchmaker {
         return &Matchmaker{
                 waitingPlayers:      make([]*ClientConnection, 0),
                 games:               make(map[string]*game.GameState),
+                gameLocks:           make(map[string]*sync.Mutex),
                 playerToGame:        make(map[string]string),
                 reconnectionTimeout: reconnectionTimeout,
                 matchmakingTimeout:  matchmakingTimeout,
+                ratingWindow:        DefaultRatingWindow,
+                waitStats:           make(map[int]*waitStats),
+                rooms:               make(map[string]*Room),
+                rematchOffers:       make(map[string]*rematchOffer),
         }
 }
 
-func (m *Matchmaker) SetGameCreatedCallback(callback func(*game.GameState)) {
+// SetRatingWindow sets how far apart in rating queued players may be.
+func (m *Matchmaker) SetRatingWindow(window RatingWindow) {
+        m.mu.Lock()
+        defer m.mu.Unlock()
+        m.ratingWindow = window
+}
+
+// SetRatingLoader sets how players' ratings are looked up when they join
+// the queue. Without one everyone is rated rating.DefaultRating.
+func (m *Matchmaker) SetRatingLoader(loader func(username string) (float64, error)) {
+        m.loadRating = loader
+}
+
+// SetGameCreatedCallback sets the function called with each new game and
+// the connections of the people playing it, whose PlayerNumber says which
+// side they are on.
+func (m *Matchmaker) SetGameCreatedCallback(callback func(*game.GameState, []*ClientConnection)) {
         m.onGameCreated = callback
 }
 
+// SetBotRatings sets the fixed ratings bots play at, by bot name. Games
+// against a bot with a rating are rated; games against other bots are not.
+func (m *Matchmaker) SetBotRatings(ratings map[string]float64) {
+        m.mu.Lock()
+        defer m.mu.Unlock()
+        m.botRatings = ratings
+}
+
 func (m *Matchmaker) AddToQueue(client *ClientConnection) {
+        client.Rating = rating.DefaultRating
+        if m.loadRating != nil {
+                if playerRating, err := m.loadRating(client.Username); err != nil {
+                        log.Printf("Failed to load rating for %s: %v", client.Username, err)
+                } else {
+                        client.Rating = playerRating
+                }
+        }
+        client.JoinedAt = time.Now()
+
         m.mu.Lock()
         m.waitingPlayers = append(m.waitingPlayers, client)
-        log.Printf("Player %s added to matchmaking queue", client.Username)
+        log.Printf("Player %s (%.0f) added to matchmaking queue", client.Username, client.Rating)
         m.mu.Unlock()
 
         m.tryMatch(client)
@@ -52,40 +117,105 @@ func (m *Matchmaker) AddToQueue(client *ClientConnection) {
 
 func (m *Matchmaker) tryMatch(client *ClientConnection) {
         m.mu.Lock()
-        defer m.mu.Unlock()
+        matched := m.matchWaiting(client)
+        m.mu.Unlock()
 
-        var otherPlayer *ClientConnection
-        for _, p := range m.waitingPlayers {
-                if p.ID != client.ID && p.GameID == "" {
-                        otherPlayer = p
-                        break
-                }
+        if !matched {
+                go m.waitForOpponent(client)
         }
+}
 
-        if otherPlayer != nil {
-                gameState := m.createGame(client, otherPlayer)
-                if m.onGameCreated != nil {
-                        go m.onGameCreated(gameState)
-                }
-        } else {
-                go func() {
-                        time.Sleep(m.matchmakingTimeout)
+// waitForOpponent looks for an opponent for client as its rating window
+// widens, and matches it with a bot once matchmakingTimeout has passed.
+func (m *Matchmaker) waitForOpponent(client *ClientConnection) {
+        ticker := time.NewTicker(matchRetryInterval)
+        defer ticker.Stop()
+        timeout := time.NewTimer(m.matchmakingTimeout)
+        defer timeout.Stop()
+
+        for {
+                select {
+                case <-ticker.C:
+                        m.mu.Lock()
+                        done := !m.isWaiting(client) || m.matchWaiting(client)
+                        m.mu.Unlock()
+                        if done {
+                                return
+                        }
+                case <-timeout.C:
                         m.mu.Lock()
                         defer m.mu.Unlock()
 
-                        if client.GameID == "" {
-                                for _, p := range m.waitingPlayers {
-                                        if p.ID == client.ID {
-                                                log.Printf("Matching %s with bot after timeout", client.Username)
-                                                gameState := m.createGameWithBot(client)
-                                                if m.onGameCreated != nil {
-                                                        go m.onGameCreated(gameState)
-                                                }
-                                                break
-                                        }
+                        if m.isWaiting(client) {
+                                log.Printf("Matching %s with bot after timeout", client.Username)
+                                m.recordWait(client, true)
+                                gameState := m.createGameWithBot(client)
+                                if m.onGameCreated != nil {
+                                        go m.onGameCreated(gameState, []*ClientConnection{client})
                                 }
                         }
-                }()
+                        return
+                }
+        }
+}
+
+// isWaiting reports whether client is still in the queue without a game.
+// The caller must hold m.mu.
+func (m *Matchmaker) isWaiting(client *ClientConnection) bool {
+        if client.GameID != "" {
+                return false
+        }
+        for _, p := range m.waitingPlayers {
+                if p.ID == client.ID {
+                        return true
+                }
+        }
+        return false
+}
+
+// matchWaiting starts a game between client and the closest rated player
+// waiting for the same variant, if both are inside each other's rating
+// window. The caller must hold m.mu.
+func (m *Matchmaker) matchWaiting(client *ClientConnection) bool {
+        now := time.Now()
+        clientWindow := m.ratingWindow.At(now.Sub(client.JoinedAt))
+
+        var otherPlayer *ClientConnection
+        bestGap := math.Inf(1)
+        for _, p := range m.waitingPlayers {
+                if p.ID == client.ID || p.GameID != "" || p.Rules != client.Rules || p.TimeControl != client.TimeControl {
+                        continue
+                }
+                gap := math.Abs(p.Rating - client.Rating)
+                if gap > clientWindow || gap > m.ratingWindow.At(now.Sub(p.JoinedAt)) {
+                        continue
+                }
+                if gap < bestGap {
+                        otherPlayer, bestGap = p, gap
+                }
+        }
+        if otherPlayer == nil {
+                return false
+        }
+
+        m.recordWait(client, false)
+        m.recordWait(otherPlayer, false)
+        gameState := m.createGame(client, otherPlayer)
+        if m.onGameCreated != nil {
+                go m.onGameCreated(gameState, []*ClientConnection{client, otherPlayer})
+        }
+        return true
+}
+
+// ChallengeBot starts a game between client and client.Bot straight away,
+// without looking for a human opponent.
+func (m *Matchmaker) ChallengeBot(client *ClientConnection) {
+        m.mu.Lock()
+        gameState := m.createGameWithBot(client)
+        m.mu.Unlock()
+
+        if m.onGameCreated != nil {
+                go m.onGameCreated(gameState, []*ClientConnection{client})
         }
 }
 
@@ -96,10 +226,16 @@ func (m *Matchmaker) createGame(player1, player2 *ClientConnection) *game.GameSt
                 ID:          gameID,
                 Player1:     player1.Username,
                 Player2:     player2.Username,
-                Board:       game.CreateBoard(),
+                Rated:       true,
+                Rules:       player1.Rules,
+                Board:       game.NewBoard(player1.Rules),
                 CurrentTurn: game.Player1,
+                TimeControl: player1.TimeControl,
                 IsFinished:  false,
+                Moves:       []game.Move{},
+                CreatedAt:   time.Now().UTC(),
         }
+        gameState.StartClock(gameState.CreatedAt)
 
         m.games[gameID] = gameState
 
@@ -123,16 +259,56 @@ func (m *Matchmaker) createGame(player1, player2 *ClientConnection) *game.GameSt
         return gameState
 }
 
+// AddRemoteBot offers a bot played by a connected client to players who
+// did not ask for a particular bot.
+func (m *Matchmaker) AddRemoteBot(strategy bot.Strategy) {
+        m.mu.Lock()
+        defer m.mu.Unlock()
+        m.remoteBots = append(m.remoteBots, strategy)
+}
+
+func (m *Matchmaker) RemoveRemoteBot(strategy bot.Strategy) {
+        m.mu.Lock()
+        defer m.mu.Unlock()
+
+        remaining := make([]bot.Strategy, 0, len(m.remoteBots))
+        for _, remote := range m.remoteBots {
+                if remote != strategy {
+                        remaining = append(remaining, remote)
+                }
+        }
+        m.remoteBots = remaining
+}
+
 func (m *Matchmaker) createGameWithBot(player *ClientConnection) *game.GameState {
         gameID := uuid.New().String()
 
+        if player.Bot == nil {
+                player.Bot = bot.DefaultDifficulty
+                if len(m.remoteBots) > 0 {
+                        player.Bot = m.remoteBots[rand.Intn(len(m.remoteBots))]
+                }
+        }
+
         gameState := &game.GameState{
-                ID:          gameID,
-                Player1:     player.Username,
-                Player2:     bot.BotUsername,
-                Board:       game.CreateBoard(),
-                CurrentTurn: game.Player1,
-                IsFinished:  false,
+                ID:               gameID,
+                Player1:          player.Username,
+                Player2:          bot.DisplayName(player.Bot),
+                Bot:              player.Bot.Name(),
+                BotOnLeaderboard: bot.OnLeaderboard(player.Bot),
+                Rules:            player.Rules,
+                Board:            game.NewBoard(player.Rules),
+                CurrentTurn:      game.Player1,
+                TimeControl:      player.TimeControl,
+                IsFinished:       false,
+                Moves:            []game.Move{},
+                CreatedAt:        time.Now().UTC(),
+        }
+        gameState.StartClock(gameState.CreatedAt)
+
+        if botRating, ok := m.botRatings[player.Bot.Name()]; ok {
+                gameState.Rated = true
+                gameState.BotRating = botRating
         }
 
         m.games[gameID] = gameState
@@ -150,7 +326,7 @@ func (m *Matchmaker) createGameWithBot(player *ClientConnection) *game.GameState
         }
         m.waitingPlayers = newWaiting
 
-        log.Printf("Game %s created: %s vs Bot", gameID, player.Username)
+        log.Printf("Game %s created: %s vs %s", gameID, player.Username, gameState.Player2)
         return gameState
 }
 
@@ -172,20 +348,58 @@ func (m *Matchmaker) GetGameByPlayer(username string) (*game.GameState, bool) {
         return gameState, exists
 }
 
+// LockGame locks a game against other goroutines until the returned
+// function is called. Anything that changes a game in progress, or reads the
+// parts of it that change, must hold its lock.
+func (m *Matchmaker) LockGame(gameID string) (unlock func()) {
+        m.mu.Lock()
+        lock, ok := m.gameLocks[gameID]
+        if !ok {
+                lock = &sync.Mutex{}
+                // A game removed since the caller found it gets a lock of
+                // its own that is not kept, so that RemoveGame stays final.
+                if _, exists := m.games[gameID]; exists {
+                        m.gameLocks[gameID] = lock
+                }
+        }
+        m.mu.Unlock()
+
+        lock.Lock()
+        return lock.Unlock
+}
+
+// SnapshotGame returns a copy of a game taken under its lock, which can be
+// read or encoded while the game carries on.
+func (m *Matchmaker) SnapshotGame(gameID string) (*game.GameState, bool) {
+        gameState, exists := m.GetGame(gameID)
+        if !exists {
+                return nil, false
+        }
+        unlock := m.LockGame(gameID)
+        defer unlock()
+        return gameState.Clone(), true
+}
+
 func (m *Matchmaker) UpdateGame(gameID string, gameState *game.GameState) {
         m.mu.Lock()
         defer m.mu.Unlock()
         m.games[gameID] = gameState
 }
 
+// RemoveGame forgets a game and its lock. Its players may have moved on to
+// other games by then, which they are still found by.
 func (m *Matchmaker) RemoveGame(gameID string) {
         m.mu.Lock()
         defer m.mu.Unlock()
 
         if gameState, exists := m.games[gameID]; exists {
-                delete(m.playerToGame, gameState.Player1)
-                delete(m.playerToGame, gameState.Player2)
+                for _, username := range []string{gameState.Player1, gameState.Player2} {
+                        if m.playerToGame[username] == gameID {
+                                delete(m.playerToGame, username)
+                        }
+                }
                 delete(m.games, gameID)
+                delete(m.gameLocks, gameID)
                 log.Printf("Game %s removed", gameID)
         }
 }
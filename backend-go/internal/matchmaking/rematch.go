@@ -0,0 +1,120 @@
+package matchmaking
+
+import (
+        "errors"
+        "fourinrow/internal/game"
+        "log"
+        "time"
+)
+
+// RematchTimeout is how long a rematch offer stays open.
+const RematchTimeout = 30 * time.Second
+
+var (
+        ErrNoRematchOffer = errors.New("no rematch has been offered")
+        ErrRematchPending = errors.New("you have already offered a rematch")
+)
+
+type rematchOffer struct {
+        from  string
+        timer *time.Timer
+}
+
+// SeriesScore counts the results of a game and the games it was a rematch
+// of.
+type SeriesScore struct {
+        Games int            `json:"games"`
+        Wins  map[string]int `json:"wins"`
+        Draws int            `json:"draws"`
+}
+
+// OfferRematch records that from wants a rematch of the finished game
+// gameID. If the opponent had already offered one it reports that both
+// players agree instead. An offer nobody answers is withdrawn after
+// RematchTimeout and expired is called.
+func (m *Matchmaker) OfferRematch(gameID, from string, expired func()) (bool, error) {
+        m.mu.Lock()
+        defer m.mu.Unlock()
+
+        if offer, ok := m.rematchOffers[gameID]; ok {
+                if offer.from == from {
+                        return false, ErrRematchPending
+                }
+                offer.timer.Stop()
+                delete(m.rematchOffers, gameID)
+                return true, nil
+        }
+
+        offer := &rematchOffer{from: from}
+        offer.timer = time.AfterFunc(RematchTimeout, func() {
+                m.mu.Lock()
+                current, ok := m.rematchOffers[gameID]
+                if ok && current == offer {
+                        delete(m.rematchOffers, gameID)
+                }
+                m.mu.Unlock()
+                if ok && current == offer {
+                        expired()
+                }
+        })
+        m.rematchOffers[gameID] = offer
+        return false, nil
+}
+
+// AnswerRematch takes the opponent's open rematch offer for gameID off the
+// table, whether to accept or decline it, and returns who made it.
+func (m *Matchmaker) AnswerRematch(gameID, username string) (string, error) {
+        m.mu.Lock()
+        defer m.mu.Unlock()
+
+        offer, ok := m.rematchOffers[gameID]
+        if !ok || offer.from == username {
+                return "", ErrNoRematchOffer
+        }
+        offer.timer.Stop()
+        delete(m.rematchOffers, gameID)
+        return offer.from, nil
+}
+
+// StartRematch creates a rematch of previous between player1 and player2,
+// who should be previous's players with colors swapped.
+func (m *Matchmaker) StartRematch(previous *game.GameState, player1, player2 *ClientConnection) *game.GameState {
+        m.mu.Lock()
+        player1.Rules = previous.Rules
+        player2.Rules = previous.Rules
+        player1.TimeControl = previous.TimeControl
+        player2.TimeControl = previous.TimeControl
+        gameState := m.createGame(player1, player2)
+        gameState.Rated = previous.Rated
+        gameState.PreviousGameID = previous.ID
+        m.mu.Unlock()
+
+        log.Printf("Game %s is a rematch of %s", gameState.ID, previous.ID)
+        if m.onGameCreated != nil {
+                go m.onGameCreated(gameState, []*ClientConnection{player1, player2})
+        }
+        return gameState
+}
+
+// Series adds up the finished games in the chain of rematches ending with
+// gameState.
+func (m *Matchmaker) Series(gameState *game.GameState) SeriesScore {
+        m.mu.RLock()
+        defer m.mu.RUnlock()
+
+        score := SeriesScore{Wins: map[string]int{gameState.Player1: 0, gameState.Player2: 0}}
+        seen := map[string]bool{}
+        for current := gameState; current != nil && !seen[current.ID]; current = m.games[current.PreviousGameID] {
+                seen[current.ID] = true
+                if !current.IsFinished {
+                        continue
+                }
+                score.Games++
+                if current.Winner == "Draw" {
+                        score.Draws++
+                } else if current.Winner != "" {
+                        score.Wins[current.Winner]++
+                }
+        }
+        return score
+}
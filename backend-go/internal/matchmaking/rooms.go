@@ -0,0 +1,181 @@
+package matchmaking
+
+import (
+        "crypto/rand"
+        "errors"
+        "fourinrow/internal/game"
+        "log"
+        "math/big"
+        "strings"
+        "time"
+)
+
+// RoomTimeout is how long a private room waits for someone to join it.
+const RoomTimeout = 10 * time.Minute
+
+// roomCodeAlphabet leaves out letters and digits that are easily confused
+// when a code is read out, such as O and 0.
+const roomCodeAlphabet = "ABCDEFGHJKLMNPQRSTUVWXYZ23456789"
+
+const roomCodeLength = 6
+
+// Who moves first in a private room.
+const (
+        FirstCreator = "creator"
+        FirstGuest   = "guest"
+        FirstRandom  = "random"
+)
+
+var (
+        ErrRoomNotFound = errors.New("no room with that code")
+        ErrOwnRoom      = errors.New("you cannot join your own room")
+        ErrSameUsername = errors.New("the room's creator already uses that username")
+)
+
+// Room is a private game slot that only a player with its code can join.
+// Games in rooms skip the queue, are never handed to a bot and are not
+// rated.
+type Room struct {
+        Code      string
+        Creator   *ClientConnection
+        // First is FirstCreator, FirstGuest or FirstRandom.
+        First     string
+        ExpiresAt time.Time
+
+        timer *time.Timer
+}
+
+// SetRoomExpiredCallback sets the function called with a room nobody
+// joined before it expired.
+func (m *Matchmaker) SetRoomExpiredCallback(callback func(*Room)) {
+        m.onRoomExpired = callback
+}
+
+// CreateRoom opens a room for creator to play in with creator.Rules and
+// creator.TimeControl, closing any room creator already had open.
+func (m *Matchmaker) CreateRoom(creator *ClientConnection, first string) (*Room, error) {
+        switch first {
+        case "":
+                first = FirstCreator
+        case FirstCreator, FirstGuest, FirstRandom:
+        default:
+                return nil, errors.New("first must be creator, guest or random")
+        }
+
+        m.mu.Lock()
+        defer m.mu.Unlock()
+
+        m.closeRooms(creator.ID)
+
+        code, err := m.newRoomCode()
+        if err != nil {
+                return nil, err
+        }
+        room := &Room{
+                Code:      code,
+                Creator:   creator,
+                First:     first,
+                ExpiresAt: time.Now().Add(RoomTimeout),
+        }
+        room.timer = time.AfterFunc(RoomTimeout, func() { m.expireRoom(room) })
+        m.rooms[code] = room
+
+        log.Printf("Room %s created by %s", code, creator.Username)
+        return room, nil
+}
+
+// JoinRoom starts the game in the room with the given code, which is
+// matched ignoring case and spaces.
+func (m *Matchmaker) JoinRoom(code string, guest *ClientConnection) (*game.GameState, error) {
+        code = strings.ToUpper(strings.ReplaceAll(code, " ", ""))
+
+        m.mu.Lock()
+        room, ok := m.rooms[code]
+        if !ok {
+                m.mu.Unlock()
+                return nil, ErrRoomNotFound
+        }
+        if room.Creator.ID == guest.ID {
+                m.mu.Unlock()
+                return nil, ErrOwnRoom
+        }
+        if room.Creator.Username == guest.Username {
+                m.mu.Unlock()
+                return nil, ErrSameUsername
+        }
+
+        room.timer.Stop()
+        delete(m.rooms, code)
+
+        guest.Rules = room.Creator.Rules
+        guest.TimeControl = room.Creator.TimeControl
+        player1, player2 := room.Creator, guest
+        if room.First == FirstGuest || (room.First == FirstRandom && randomBool()) {
+                player1, player2 = guest, room.Creator
+        }
+        gameState := m.createGame(player1, player2)
+        gameState.Rated = false
+        m.mu.Unlock()
+
+        log.Printf("%s joined room %s", guest.Username, code)
+        if m.onGameCreated != nil {
+                go m.onGameCreated(gameState, []*ClientConnection{player1, player2})
+        }
+        return gameState, nil
+}
+
+// CloseRooms closes the rooms a disconnected client created.
+func (m *Matchmaker) CloseRooms(clientID string) {
+        m.mu.Lock()
+        defer m.mu.Unlock()
+        m.closeRooms(clientID)
+}
+
+// closeRooms closes clientID's rooms. The caller must hold m.mu.
+func (m *Matchmaker) closeRooms(clientID string) {
+        for code, room := range m.rooms {
+                if room.Creator.ID == clientID {
+                        room.timer.Stop()
+                        delete(m.rooms, code)
+                }
+        }
+}
+
+func (m *Matchmaker) expireRoom(room *Room) {
+        m.mu.Lock()
+        if m.rooms[room.Code] != room {
+                m.mu.Unlock()
+                return
+        }
+        delete(m.rooms, room.Code)
+        m.mu.Unlock()
+
+        log.Printf("Room %s expired", room.Code)
+        if m.onRoomExpired != nil {
+                m.onRoomExpired(room)
+        }
+}
+
+// newRoomCode picks a code no open room is using. The caller must hold
+// m.mu.
+func (m *Matchmaker) newRoomCode() (string, error) {
+        max := big.NewInt(int64(len(roomCodeAlphabet)))
+        for {
+                var code strings.Builder
+                for i := 0; i < roomCodeLength; i++ {
+                        n, err := rand.Int(rand.Reader, max)
+                        if err != nil {
+                                return "", err
+                        }
+                        code.WriteByte(roomCodeAlphabet[n.Int64()])
+                }
+                if _, taken := m.rooms[code.String()]; !taken {
+                        return code.String(), nil
+                }
+        }
+}
+
+func randomBool() bool {
+        n, err := rand.Int(rand.Reader, big.NewInt(2))
+        return err == nil && n.Int64() == 1
+}
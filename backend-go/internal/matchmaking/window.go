@@ -0,0 +1,133 @@
+package matchmaking
+
+import (
+        "fmt"
+        "math"
+        "sort"
+        "strconv"
+        "strings"
+        "time"
+)
+
+// RatingWindow is how far apart in rating two queued players may be and
+// still be matched. The window starts at Initial and widens by PerSecond
+// for every second a player has waited, up to Max. Both players must be
+// inside each other's window.
+type RatingWindow struct {
+        Initial   float64 `json:"initial"`
+        PerSecond float64 `json:"perSecond"`
+        Max       float64 `json:"max"`
+}
+
+// DefaultRatingWindow matches players within 100 points at first and
+// anyone within 600 by the time the bot would take over.
+var DefaultRatingWindow = RatingWindow{Initial: 100, PerSecond: 50, Max: 600}
+
+// ParseRatingWindow reads a window written as "initial,perSecond,max".
+func ParseRatingWindow(s string) (RatingWindow, error) {
+        parts := strings.Split(s, ",")
+        if len(parts) != 3 {
+                return RatingWindow{}, fmt.Errorf("rating window %q is not initial,perSecond,max", s)
+        }
+        var values [3]float64
+        for i, part := range parts {
+                value, err := strconv.ParseFloat(strings.TrimSpace(part), 64)
+                if err != nil || value < 0 {
+                        return RatingWindow{}, fmt.Errorf("rating window %q is not initial,perSecond,max", s)
+                }
+                values[i] = value
+        }
+        return RatingWindow{Initial: values[0], PerSecond: values[1], Max: values[2]}, nil
+}
+
+// At returns the window for a player who has waited for waited.
+func (w RatingWindow) At(waited time.Duration) float64 {
+        return math.Min(w.Initial+w.PerSecond*waited.Seconds(), w.Max)
+}
+
+// BracketSize is the width of the rating brackets queue statistics are
+// grouped into.
+const BracketSize = 200
+
+// BracketStats describes the queue for players rated from MinRating up to
+// but not including MaxRating. Waits are counted from joining the queue to
+// being matched with a person or with the bot.
+type BracketStats struct {
+        MinRating          int     `json:"minRating"`
+        MaxRating          int     `json:"maxRating"`
+        Waiting            int     `json:"waiting"`
+        Matched            int     `json:"matched"`
+        BotGames           int     `json:"botGames"`
+        AverageWaitSeconds float64 `json:"averageWaitSeconds"`
+        LongestWaitSeconds float64 `json:"longestWaitSeconds"`
+}
+
+type waitStats struct {
+        matched  int
+        botGames int
+        total    time.Duration
+        longest  time.Duration
+}
+
+func bracketOf(rating float64) int {
+        return int(math.Floor(rating/BracketSize)) * BracketSize
+}
+
+// recordWait notes how long player waited before being matched. The
+// caller must hold m.mu.
+func (m *Matchmaker) recordWait(player *ClientConnection, withBot bool) {
+        bracket := bracketOf(player.Rating)
+        stats, ok := m.waitStats[bracket]
+        if !ok {
+                stats = &waitStats{}
+                m.waitStats[bracket] = stats
+        }
+
+        waited := time.Since(player.JoinedAt)
+        if withBot {
+                stats.botGames++
+        } else {
+                stats.matched++
+        }
+        stats.total += waited
+        if waited > stats.longest {
+                stats.longest = waited
+        }
+}
+
+// QueueStats returns the number of players waiting and the wait times so
+// far in each rating bracket, lowest bracket first.
+func (m *Matchmaker) QueueStats() []BracketStats {
+        m.mu.RLock()
+        defer m.mu.RUnlock()
+
+        brackets := make(map[int]*BracketStats)
+        bracketFor := func(minRating int) *BracketStats {
+                if _, ok := brackets[minRating]; !ok {
+                        brackets[minRating] = &BracketStats{MinRating: minRating, MaxRating: minRating + BracketSize}
+                }
+                return brackets[minRating]
+        }
+
+        for minRating, stats := range m.waitStats {
+                bracket := bracketFor(minRating)
+                bracket.Matched = stats.matched
+                bracket.BotGames = stats.botGames
+                if n := stats.matched + stats.botGames; n > 0 {
+                        bracket.AverageWaitSeconds = stats.total.Seconds() / float64(n)
+                }
+                bracket.LongestWaitSeconds = stats.longest.Seconds()
+        }
+        for _, p := range m.waitingPlayers {
+                if p.GameID == "" {
+                        bracketFor(bracketOf(p.Rating)).Waiting++
+                }
+        }
+
+        result := make([]BracketStats, 0, len(brackets))
+        for _, bracket := range brackets {
+                result = append(result, *bracket)
+        }
+        sort.Slice(result, func(i, j int) bool { return result[i].MinRating < result[j].MinRating })
+        return result
+}
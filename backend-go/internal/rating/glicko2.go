@@ -0,0 +1,134 @@
+// Package rating implements the Glicko-2 rating system. The server treats
+// every game as its own rating period.
+package rating
+
+import "math"
+
+const (
+        DefaultRating     = 1500.0
+        DefaultDeviation  = 350.0
+        DefaultVolatility = 0.06
+
+        // BotDeviation is the deviation given to bots, whose rating is set
+        // by configuration rather than earned, so that games against them
+        // count about as much as games against an established player.
+        BotDeviation = 50.0
+
+        // tau limits how quickly volatility changes.
+        tau = 0.5
+        // scale converts between the Glicko and Glicko-2 scales.
+        scale = 173.7178
+        // epsilon is the tolerance of the volatility iteration.
+        epsilon = 0.000001
+)
+
+// Rating is a player's rating, its deviation (how uncertain it is) and
+// volatility (how erratic the player's results are).
+type Rating struct {
+        Rating     float64 `json:"rating"`
+        Deviation  float64 `json:"ratingDeviation"`
+        Volatility float64 `json:"volatility"`
+}
+
+// New returns the rating of a player who has not played a rated game.
+func New() Rating {
+        return Rating{Rating: DefaultRating, Deviation: DefaultDeviation, Volatility: DefaultVolatility}
+}
+
+// Fixed returns the rating of a bot playing at rating.
+func Fixed(rating float64) Rating {
+        return Rating{Rating: rating, Deviation: BotDeviation, Volatility: DefaultVolatility}
+}
+
+// Result is one game of a rating period: the opponent's rating going into
+// the period and the score, 1 for a win, 0.5 for a draw and 0 for a loss.
+type Result struct {
+        Opponent Rating
+        Score    float64
+}
+
+// Update returns player's rating after a game against opponent, where
+// score is 1 for a win, 0.5 for a draw and 0 for a loss.
+func Update(player, opponent Rating, score float64) Rating {
+        return UpdatePeriod(player, []Result{{Opponent: opponent, Score: score}})
+}
+
+// UpdatePeriod returns player's rating after a rating period in which they
+// played the given games. A player who did not play only grows less
+// certain.
+func UpdatePeriod(player Rating, results []Result) Rating {
+        mu := (player.Rating - DefaultRating) / scale
+        phi := player.Deviation / scale
+
+        if len(results) == 0 {
+                phiStar := math.Sqrt(phi*phi + player.Volatility*player.Volatility)
+                return Rating{
+                        Rating:     player.Rating,
+                        Deviation:  math.Min(phiStar*scale, DefaultDeviation),
+                        Volatility: player.Volatility,
+                }
+        }
+
+        // vInverse is 1/v and improvement is delta/v in Glickman's
+        // notation.
+        var vInverse, improvement float64
+        for _, result := range results {
+                muOpponent := (result.Opponent.Rating - DefaultRating) / scale
+                phiOpponent := result.Opponent.Deviation / scale
+
+                g := 1 / math.Sqrt(1+3*phiOpponent*phiOpponent/(math.Pi*math.Pi))
+                expected := 1 / (1 + math.Exp(-g*(mu-muOpponent)))
+                vInverse += g * g * expected * (1 - expected)
+                improvement += g * (result.Score - expected)
+        }
+        v := 1 / vInverse
+        delta := v * improvement
+
+        sigma := newVolatility(phi, player.Volatility, v, delta)
+
+        phiStar := math.Sqrt(phi*phi + sigma*sigma)
+        newPhi := 1 / math.Sqrt(1/(phiStar*phiStar)+1/v)
+        newMu := mu + newPhi*newPhi*improvement
+
+        return Rating{
+                Rating:     newMu*scale + DefaultRating,
+                Deviation:  math.Min(newPhi*scale, DefaultDeviation),
+                Volatility: sigma,
+        }
+}
+
+// newVolatility solves for the new volatility with the Illinois algorithm,
+// step 5 of Glickman's description of Glicko-2.
+func newVolatility(phi, sigma, v, delta float64) float64 {
+        a := math.Log(sigma * sigma)
+        f := func(x float64) float64 {
+                ex := math.Exp(x)
+                d := phi*phi + v + ex
+                return ex*(delta*delta-phi*phi-v-ex)/(2*d*d) - (x-a)/(tau*tau)
+        }
+
+        lower := a
+        var upper float64
+        if delta*delta > phi*phi+v {
+                upper = math.Log(delta*delta - phi*phi - v)
+        } else {
+                k := 1.0
+                for f(a-k*tau) < 0 {
+                        k++
+                }
+                upper = a - k*tau
+        }
+
+        fLower, fUpper := f(lower), f(upper)
+        for math.Abs(upper-lower) > epsilon {
+                c := lower + (lower-upper)*fLower/(fUpper-fLower)
+                fc := f(c)
+                if fc*fUpper <= 0 {
+                        lower, fLower = upper, fUpper
+                } else {
+                        fLower /= 2
+                }
+                upper, fUpper = c, fc
+        }
+        return math.Exp(lower / 2)
+}
@@ -0,0 +1,69 @@
+package rating
+
+import (
+        "math"
+        "testing"
+)
+
+// TestGlickmanExample checks the worked example in Glickman's description
+// of Glicko-2: a 1500 player with deviation 200 beats a 1400 player and
+// loses to 1550 and 1700 players in one rating period.
+func TestGlickmanExample(t *testing.T) {
+        player := Rating{Rating: 1500, Deviation: 200, Volatility: 0.06}
+        results := []Result{
+                {Opponent: Rating{Rating: 1400, Deviation: 30, Volatility: 0.06}, Score: 1},
+                {Opponent: Rating{Rating: 1550, Deviation: 100, Volatility: 0.06}, Score: 0},
+                {Opponent: Rating{Rating: 1700, Deviation: 300, Volatility: 0.06}, Score: 0},
+        }
+
+        got := UpdatePeriod(player, results)
+        if math.Abs(got.Rating-1464.06) > 0.01 {
+                t.Errorf("rating = %.4f, want 1464.06", got.Rating)
+        }
+        if math.Abs(got.Deviation-151.52) > 0.01 {
+                t.Errorf("deviation = %.4f, want 151.52", got.Deviation)
+        }
+        // The paper truncates the volatility to 0.05999.
+        if got.Volatility < 0.05999 || got.Volatility >= 0.06 {
+                t.Errorf("volatility = %.6f, want 0.05999", got.Volatility)
+        }
+}
+
+func TestUpdateIsOneGamePeriod(t *testing.T) {
+        player, opponent := New(), Fixed(1700)
+        for _, score := range []float64{0, 0.5, 1} {
+                if got, want := Update(player, opponent, score), UpdatePeriod(player, []Result{{Opponent: opponent, Score: score}}); got != want {
+                        t.Errorf("Update with score %v = %+v, want %+v", score, got, want)
+                }
+        }
+}
+
+func TestUpdateDirection(t *testing.T) {
+        player, opponent := Rating{Rating: 1600, Deviation: 80, Volatility: 0.06}, Fixed(1600)
+
+        win := Update(player, opponent, 1)
+        draw := Update(player, opponent, 0.5)
+        loss := Update(player, opponent, 0)
+        if !(win.Rating > draw.Rating && draw.Rating > loss.Rating) {
+                t.Errorf("ratings after win, draw, loss = %.1f, %.1f, %.1f, want decreasing", win.Rating, draw.Rating, loss.Rating)
+        }
+        if math.Abs(draw.Rating-player.Rating) > 0.01 {
+                t.Errorf("a draw between equals moved the rating to %.2f", draw.Rating)
+        }
+        if win.Deviation >= player.Deviation {
+                t.Errorf("deviation after a game = %.1f, want less than %.1f", win.Deviation, player.Deviation)
+        }
+}
+
+func TestUpdatePeriodWithoutGames(t *testing.T) {
+        player := Rating{Rating: 1500, Deviation: 200, Volatility: 0.06}
+        got := UpdatePeriod(player, nil)
+        want := math.Sqrt(200*200 + 0.06*0.06*scale*scale)
+        if got.Rating != 1500 || math.Abs(got.Deviation-want) > 1e-9 || got.Volatility != 0.06 {
+                t.Errorf("UpdatePeriod with no games = %+v, want deviation %.4f only", got, want)
+        }
+
+        if got := UpdatePeriod(New(), nil); got.Deviation != DefaultDeviation {
+                t.Errorf("deviation grew past %v to %v", DefaultDeviation, got.Deviation)
+        }
+}
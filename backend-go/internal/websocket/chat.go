@@ -0,0 +1,156 @@
+package websocket
+
+import (
+        "encoding/json"
+        "fourinrow/internal/chat"
+        "fourinrow/internal/game"
+        "time"
+)
+
+// SetChatFilter sets the filter chat messages pass through before they are
+// delivered. With no filter messages are delivered as written.
+func (h *Hub) SetChatFilter(filter chat.Filter) {
+        h.chatFilter = filter
+}
+
+// SetStoreChat sets whether chat messages are kept in the game's transcript,
+// and so saved with the game.
+func (h *Hub) SetStoreChat(store bool) {
+        h.storeChat = store
+}
+
+// HandleChat sends a chat message to everyone in the client's game: the
+// players and the spectators.
+func (h *Hub) HandleChat(client *Client, text string) {
+        gameState, from, spectator, ok := h.chatGame(client)
+        if !ok {
+                return
+        }
+
+        text, err := chat.Validate(text)
+        if err != nil {
+                h.sendError(client, err.Error())
+                return
+        }
+        if !client.chatLimiter.Allow(time.Now()) {
+                h.sendError(client, chat.ErrRateLimit.Error())
+                return
+        }
+        if h.chatFilter != nil {
+                text, err = h.chatFilter.Filter(text)
+                if err != nil {
+                        h.sendError(client, err.Error())
+                        return
+                }
+        }
+
+        line := game.ChatLine{From: from, Text: text, Spectator: spectator, Timestamp: time.Now().UTC()}
+        if h.storeChat {
+                // The transcript is saved when the game ends, so lines sent
+                // after that are delivered but not kept.
+                unlock := h.matchmaker.LockGame(gameState.ID)
+                if !gameState.IsFinished {
+                        gameState.Chat = append(gameState.Chat, line)
+                }
+                unlock()
+        }
+
+        h.sendChat(gameState, from, Message{Type: "chat", Data: line})
+}
+
+// HandleReaction sends one of the quick reactions to everyone in the
+// client's game. Reactions count towards the chat rate limit but are not
+// kept in transcripts.
+func (h *Hub) HandleReaction(client *Client, reaction string) {
+        gameState, from, spectator, ok := h.chatGame(client)
+        if !ok {
+                return
+        }
+
+        if !chat.IsReaction(reaction) {
+                h.sendError(client, chat.ErrReaction.Error())
+                return
+        }
+        if !client.chatLimiter.Allow(time.Now()) {
+                h.sendError(client, chat.ErrRateLimit.Error())
+                return
+        }
+
+        h.sendChat(gameState, from, Message{
+                Type: "reaction",
+                Data: map[string]interface{}{
+                        "from":      from,
+                        "reaction":  reaction,
+                        "spectator": spectator,
+                },
+        })
+}
+
+// HandleMute stops the client receiving chat and reactions from username,
+// who may be the opponent or a spectator.
+func (h *Hub) HandleMute(client *Client, username string) {
+        if username == "" || username == client.Username {
+                h.sendError(client, "Choose someone else to mute")
+                return
+        }
+
+        h.mu.Lock()
+        if client.Muted == nil {
+                client.Muted = make(map[string]bool)
+        }
+        client.Muted[username] = true
+        h.mu.Unlock()
+
+        h.sendToClient(client, Message{Type: "muted", Data: map[string]interface{}{"username": username}})
+}
+
+// HandleUnmute undoes HandleMute.
+func (h *Hub) HandleUnmute(client *Client, username string) {
+        h.mu.Lock()
+        delete(client.Muted, username)
+        h.mu.Unlock()
+
+        h.sendToClient(client, Message{Type: "unmuted", Data: map[string]interface{}{"username": username}})
+}
+
+// chatGame finds the game the client can chat in, the game it is watching
+// or else the game it is seated in, finished or not, and the name its
+// messages are shown under. Spectators without a username are named after
+// their connection.
+func (h *Hub) chatGame(client *Client) (*game.GameState, string, bool, bool) {
+        h.mu.RLock()
+        watching, playing := client.Spectating, client.GameID
+        h.mu.RUnlock()
+
+        if watching != "" {
+                gameState, exists := h.matchmaker.GetGame(watching)
+                if exists {
+                        from := client.Username
+                        if from == "" {
+                                from = "spectator-" + client.ID[:8]
+                        }
+                        return gameState, from, true, true
+                }
+        }
+
+        if playing != "" {
+                if gameState, exists := h.matchmaker.GetGame(playing); exists {
+                        return gameState, client.Username, false, true
+                }
+        }
+
+        h.sendError(client, "You are not in a game")
+        return nil, "", false, false
+}
+
+// sendChat delivers a chat message or reaction to the players and the
+// spectators of a game, leaving out anyone who has muted its sender.
+func (h *Hub) sendChat(gameState *game.GameState, from string, message Message) {
+        messageBytes, _ := json.Marshal(message)
+
+        h.mu.RLock()
+        defer h.mu.RUnlock()
+        h.sendToRoom(gameState.ID, messageBytes, func(client *Client) bool {
+                return client.Muted[from]
+        })
+}
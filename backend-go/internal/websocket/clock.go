@@ -0,0 +1,27 @@
+package websocket
+
+import (
+        "fourinrow/internal/game"
+        "time"
+)
+
+// watchClocks ends games whose player to move has run out of time. Each
+// game is checked under its lock, so a move and its clock running out
+// cannot both end it.
+func (h *Hub) watchClocks() {
+        ticker := time.NewTicker(clockCheckInterval)
+        defer ticker.Stop()
+
+        for now := range ticker.C {
+                for _, gameState := range h.matchmaker.GetAllGames() {
+                        if !gameState.TimeControl.Enabled() {
+                                continue
+                        }
+                        unlock := h.matchmaker.LockGame(gameState.ID)
+                        if player := gameState.CurrentTurn; !gameState.IsFinished && gameState.TimeLeft(player, now) <= 0 {
+                                h.handleGameEnd(gameState, player.Opponent(), false, game.ReasonTimeout)
+                        }
+                        unlock()
+                }
+        }
+}
@@ -0,0 +1,56 @@
+package websocket
+
+import (
+        "time"
+)
+
+// finishedGameRetention is how long a finished game stays in memory after
+// it has been handed to the listener, long enough for its players to offer
+// a rematch. After that it is served from storage.
+const finishedGameRetention = 5 * time.Minute
+
+// gameEvent is a notification waiting for the game event listener.
+type gameEvent struct {
+        name   string
+        gameID string
+        data   interface{}
+}
+
+// emit queues an event for the listener. Events are often raised with a
+// game's lock held, and the listener saves games and writes to Kafka, so
+// deliverEvents hands them over from its own goroutine, one at a time and
+// in the order they were raised.
+func (h *Hub) emit(name, gameID string, data interface{}) {
+        h.eventsMu.Lock()
+        h.events = append(h.events, gameEvent{name: name, gameID: gameID, data: data})
+        h.eventsMu.Unlock()
+
+        select {
+        case h.eventsReady <- struct{}{}:
+        default:
+        }
+}
+
+// deliverEvents passes queued events to the listener. Once a game_ended
+// event has been delivered the game is saved, and it is dropped from
+// memory after finishedGameRetention.
+func (h *Hub) deliverEvents() {
+        for range h.eventsReady {
+                h.eventsMu.Lock()
+                events := h.events
+                h.events = nil
+                h.eventsMu.Unlock()
+
+                for _, event := range events {
+                        if h.onGameEvent != nil {
+                                h.onGameEvent(event.name, event.data)
+                        }
+                        if event.name == "game_ended" {
+                                gameID := event.gameID
+                                time.AfterFunc(finishedGameRetention, func() {
+                                        h.matchmaker.RemoveGame(gameID)
+                                })
+                        }
+                }
+        }
+}
@@ -0,0 +1,180 @@
+package websocket
+
+import (
+        "fourinrow/internal/game"
+)
+
+// gameRoom holds the connections bound to one game: the players, by the
+// seat they play, and the spectators. Messages about a game go to its room
+// rather than to every client with a matching username.
+type gameRoom struct {
+        players    map[*Client]game.Player
+        spectators map[*Client]bool
+}
+
+// room returns the room of gameID, creating it if needed. The caller must
+// hold h.mu.
+func (h *Hub) room(gameID string) *gameRoom {
+        r, ok := h.rooms[gameID]
+        if !ok {
+                r = &gameRoom{
+                        players:    make(map[*Client]game.Player),
+                        spectators: make(map[*Client]bool),
+                }
+                h.rooms[gameID] = r
+        }
+        return r
+}
+
+// joinAsPlayer seats client in the room of gameID as player, taking it out
+// of any room it was in before. The caller must hold h.mu.
+func (h *Hub) joinAsPlayer(client *Client, gameID string, player game.Player) {
+        h.leaveAsPlayer(client)
+        h.leaveAsSpectator(client)
+        h.room(gameID).players[client] = player
+        client.GameID = gameID
+        client.PlayerNumber = player
+}
+
+// joinAsSpectator adds client to the spectators of gameID, taking it out of
+// any room it was in before. The caller must hold h.mu.
+func (h *Hub) joinAsSpectator(client *Client, gameID string) {
+        h.leaveAsPlayer(client)
+        h.leaveAsSpectator(client)
+        h.room(gameID).spectators[client] = true
+        client.Spectating = gameID
+}
+
+// leaveAsPlayer gives up client's seat. The caller must hold h.mu.
+func (h *Hub) leaveAsPlayer(client *Client) {
+        if client.GameID == "" {
+                return
+        }
+        if r, ok := h.rooms[client.GameID]; ok {
+                delete(r.players, client)
+                h.closeIfEmpty(client.GameID, r)
+        }
+        client.GameID = ""
+        client.PlayerNumber = game.Empty
+}
+
+// leaveAsSpectator stops client watching its game and returns the game it
+// was watching, if any. The caller must hold h.mu.
+func (h *Hub) leaveAsSpectator(client *Client) string {
+        gameID := client.Spectating
+        if gameID == "" {
+                return ""
+        }
+        if r, ok := h.rooms[gameID]; ok {
+                delete(r.spectators, client)
+                h.closeIfEmpty(gameID, r)
+        }
+        client.Spectating = ""
+        return gameID
+}
+
+func (h *Hub) closeIfEmpty(gameID string, r *gameRoom) {
+        if len(r.players) == 0 && len(r.spectators) == 0 {
+                delete(h.rooms, gameID)
+        }
+}
+
+// removeClient forgets a client for good: it leaves its room, and its Send
+// channel is closed. The caller must hold h.mu.
+func (h *Hub) removeClient(client *Client) {
+        if _, ok := h.clients[client]; !ok {
+                return
+        }
+        h.leaveAsPlayer(client)
+        h.leaveAsSpectator(client)
+        delete(h.clients, client)
+        delete(h.clientsByID, client.ID)
+        close(client.Send)
+}
+
+// playing reports whether client has a seat in a game in progress.
+func (h *Hub) playing(client *Client) bool {
+        h.mu.RLock()
+        gameID := client.GameID
+        h.mu.RUnlock()
+
+        gameState, exists := h.matchmaker.GetGame(gameID)
+        if !exists {
+                return false
+        }
+        unlock := h.matchmaker.LockGame(gameID)
+        defer unlock()
+        return !gameState.IsFinished
+}
+
+// seat returns the connected client playing as player in gameID, or nil.
+func (h *Hub) seat(gameID string, player game.Player) *Client {
+        h.mu.RLock()
+        defer h.mu.RUnlock()
+
+        if r, ok := h.rooms[gameID]; ok {
+                for client, seat := range r.players {
+                        if seat == player && !client.Disconnected {
+                                return client
+                        }
+                }
+        }
+        return nil
+}
+
+// spectatorCount is the number of clients watching gameID. The caller must
+// hold h.mu.
+func (h *Hub) spectatorCount(gameID string) int {
+        if r, ok := h.rooms[gameID]; ok {
+                return len(r.spectators)
+        }
+        return 0
+}
+
+// sendToRoom delivers a message to everyone in the room of gameID that
+// skip does not leave out. A nil skip leaves out nobody. The caller must
+// hold h.mu.
+func (h *Hub) sendToRoom(gameID string, message []byte, skip func(*Client) bool) {
+        r, ok := h.rooms[gameID]
+        if !ok {
+                return
+        }
+        deliver := func(client *Client) {
+                if skip != nil && skip(client) {
+                        return
+                }
+                select {
+                case client.Send <- message:
+                default:
+                }
+        }
+        for client := range r.players {
+                deliver(client)
+        }
+        for client := range r.spectators {
+                deliver(client)
+        }
+}
+
+// sendToGame delivers a message to the players and the spectators of a
+// game.
+func (h *Hub) sendToGame(gameID string, message []byte) {
+        h.mu.RLock()
+        defer h.mu.RUnlock()
+        h.sendToRoom(gameID, message, nil)
+}
+
+// sendToPlayers delivers a message to the players of a game only.
+func (h *Hub) sendToPlayers(gameID string, message []byte) {
+        h.mu.RLock()
+        defer h.mu.RUnlock()
+
+        if r, ok := h.rooms[gameID]; ok {
+                for client := range r.players {
+                        select {
+                        case client.Send <- message:
+                        default:
+                        }
+                }
+        }
+}
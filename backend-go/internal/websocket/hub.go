@@ -1,8 +1,11 @@
 package websocket
 
 import (
+        "context"
         "encoding/json"
+        "errors"
         "fourinrow/internal/bot"
+        "fourinrow/internal/chat"
         "fourinrow/internal/game"
         "fourinrow/internal/matchmaking"
         "log"
@@ -23,38 +26,98 @@ type Client struct {
         PlayerNumber   game.Player
         Disconnected   bool
         DisconnectedAt time.Time
+        // RemoteBot is set once the client has authenticated as a bot.
+        RemoteBot      *RemoteBot
+        // Spectating is the game the client is watching, if any.
+        Spectating     string
+        // Muted holds the names whose chat the client does not want.
+        Muted          map[string]bool
+
+        chatLimiter chat.Limiter
+        // hinting is set while a hint is being worked out for the client.
+        hinting     bool
 }
 
 type Hub struct {
         clients      map[*Client]bool
+        clientsByID  map[string]*Client
         broadcast    chan []byte
         register     chan *Client
         unregister   chan *Client
         mu           sync.RWMutex
         matchmaker   *matchmaking.Matchmaker
         onGameEvent  func(string, interface{})
+        loadGame     func(string) (*game.GameState, error)
+        botAPIKeys   map[string]string
+        timeControl  game.TimeControl
+        resumeTokens map[string]resumeSession
+        // rooms holds the connections bound to each game by game ID.
+        rooms        map[string]*gameRoom
+        chatFilter   chat.Filter
+        storeChat    bool
+        // events holds the game events waiting for onGameEvent.
+        events       []gameEvent
+        eventsMu     sync.Mutex
+        eventsReady  chan struct{}
 }
 
 type Message struct {
-        Type     string      `json:"type"`
-        Data     interface{} `json:"data,omitempty"`
-        Username string      `json:"username,omitempty"`
-        Column   int         `json:"column,omitempty"`
-        GameID   string      `json:"gameId,omitempty"`
+        Type       string      `json:"type"`
+        Data       interface{} `json:"data,omitempty"`
+        Username   string      `json:"username,omitempty"`
+        Column     int         `json:"column,omitempty"`
+        GameID     string      `json:"gameId,omitempty"`
+        Speed      float64     `json:"speed,omitempty"`
+        Variant    string      `json:"variant,omitempty"`
+        Difficulty string      `json:"difficulty,omitempty"`
+        Bot        string      `json:"bot,omitempty"`
+        Kind       string      `json:"kind,omitempty"`
+        RequestID  string      `json:"requestId,omitempty"`
+        APIKey     string      `json:"apiKey,omitempty"`
+        Code       string      `json:"code,omitempty"`
+        First      string      `json:"first,omitempty"`
+        TimeControl string      `json:"timeControl,omitempty"`
+        Token      string      `json:"token,omitempty"`
+        Text       string      `json:"text,omitempty"`
+        Reaction   string      `json:"reaction,omitempty"`
 }
 
+const maxReplayDelay = 3 * time.Second
+
+// botMoveTimeout is the deadline bot strategies are given for each move.
+const botMoveTimeout = 5 * time.Second
+
+// DefaultTimeControl is the clock games are played with unless the server
+// or the players choose another: none.
+var DefaultTimeControl = game.TimeControl{}
+
+// clockCheckInterval is how often the hub looks for players who have run
+// out of time.
+const clockCheckInterval = 100 * time.Millisecond
+
 func NewHub(matchmaker *matchmaking.Matchmaker) *Hub {
         hub := &Hub{
-                broadcast:  make(chan []byte, 256),
-                register:   make(chan *Client),
-                unregister: make(chan *Client),
-                clients:    make(map[*Client]bool),
-                matchmaker: matchmaker,
+                broadcast:   make(chan []byte, 256),
+                register:    make(chan *Client),
+                unregister:  make(chan *Client),
+                clients:     make(map[*Client]bool),
+                clientsByID: make(map[string]*Client),
+                matchmaker:  matchmaker,
+                timeControl: DefaultTimeControl,
+                resumeTokens: make(map[string]resumeSession),
+                rooms:        make(map[string]*gameRoom),
+                eventsReady:  make(chan struct{}, 1),
         }
 
-        matchmaker.SetGameCreatedCallback(func(gameState *game.GameState) {
-                hub.handleGameCreated(gameState)
-        })
+        hub.loadGame = func(gameID string) (*game.GameState, error) {
+                if gameState, exists := matchmaker.SnapshotGame(gameID); exists {
+                        return gameState, nil
+                }
+                return nil, errors.New("game not found")
+        }
+
+        matchmaker.SetGameCreatedCallback(hub.handleGameCreated)
+        matchmaker.SetRoomExpiredCallback(hub.handleRoomExpired)
 
         return hub
 }
@@ -63,31 +126,60 @@ func (h *Hub) SetGameEventCallback(callback func(string, interface{})) {
         h.onGameEvent = callback
 }
 
+// SetGameLoader replaces the lookup used to find games for replay, so that
+// finished games can be served from storage as well as from memory. Games
+// in memory must be returned as snapshots, see Matchmaker.SnapshotGame.
+func (h *Hub) SetGameLoader(loader func(string) (*game.GameState, error)) {
+        h.loadGame = loader
+}
+
+// SetDefaultTimeControl sets the clock used when a player does not ask for
+// one.
+func (h *Hub) SetDefaultTimeControl(timeControl game.TimeControl) {
+        h.timeControl = timeControl
+}
+
 func (h *Hub) Run() {
+        go h.watchClocks()
+        go h.deliverEvents()
+
         for {
                 select {
                 case client := <-h.register:
                         h.mu.Lock()
                         h.clients[client] = true
+                        h.clientsByID[client.ID] = client
                         h.mu.Unlock()
                         log.Printf("Client registered: %s", client.ID)
 
+                        // Reading starts only now so that the client's
+                        // first message finds it registered.
+                        go client.WritePump()
+                        go client.ReadPump()
+
                 case client := <-h.unregister:
                         h.mu.Lock()
+                        watched := h.leaveAsSpectator(client)
                         if _, ok := h.clients[client]; ok {
+                                if client.RemoteBot != nil {
+                                        h.removeRemoteBot(client.RemoteBot)
+                                }
+                                h.matchmaker.CloseRooms(client.ID)
                                 if client.GameID != "" {
                                         client.Disconnected = true
                                         client.DisconnectedAt = time.Now()
                                         log.Printf("Client disconnected: %s (username: %s), will wait 30s for reconnection", client.ID, client.Username)
                                         go h.handleDisconnectionTimeout(client)
                                 } else {
-                                        delete(h.clients, client)
-                                        close(client.Send)
+                                        h.removeClient(client)
                                         h.matchmaker.RemoveFromQueue(client.ID)
                                         log.Printf("Client unregistered: %s", client.ID)
                                 }
                         }
                         h.mu.Unlock()
+                        if watched != "" {
+                                h.sendSpectatorCount(watched)
+                        }
 
                 case message := <-h.broadcast:
                         h.mu.RLock()
@@ -104,10 +196,7 @@ func (h *Hub) Run() {
                         if len(deadClients) > 0 {
                                 h.mu.Lock()
                                 for _, client := range deadClients {
-                                        if _, ok := h.clients[client]; ok {
-                                                close(client.Send)
-                                                delete(h.clients, client)
-                                        }
+                                        h.removeClient(client)
                                 }
                                 h.mu.Unlock()
                         }
@@ -115,81 +204,190 @@ func (h *Hub) Run() {
         }
 }
 
-func (h *Hub) handleGameCreated(gameState *game.GameState) {
-        h.mu.RLock()
-        defer h.mu.RUnlock()
+// handleGameCreated seats the players' connections in the new game's room
+// and sends each of them game_start.
+func (h *Hub) handleGameCreated(gameState *game.GameState, players []*matchmaking.ClientConnection) {
+        unlock := h.matchmaker.LockGame(gameState.ID)
 
-        for client := range h.clients {
-                if client.Username == gameState.Player1 || client.Username == gameState.Player2 {
-                        yourTurn := client.Username == gameState.Player1
-                        response := Message{
-                                Type: "game_start",
-                                Data: map[string]interface{}{
-                                        "gameId":  gameState.ID,
-                                        "player1": gameState.Player1,
-                                        "player2": gameState.Player2,
-                                        "yourTurn": yourTurn,
-                                },
-                        }
-                        responseBytes, _ := json.Marshal(response)
-                        select {
-                        case client.Send <- responseBytes:
-                        default:
-                        }
+        var series matchmaking.SeriesScore
+        if gameState.PreviousGameID != "" {
+                series = h.matchmaker.Series(gameState)
+        }
+
+        h.mu.Lock()
+        watched := []string{}
+        for _, conn := range players {
+                client, ok := h.clientsByID[conn.ID]
+                if !ok {
+                        continue
+                }
+                if gameID := h.leaveAsSpectator(client); gameID != "" {
+                        watched = append(watched, gameID)
+                }
+                // The seat the client gives up cannot be resumed.
+                if client.GameID != "" && client.GameID != gameState.ID {
+                        h.dropResumeTokens(client.GameID, client.PlayerNumber)
+                }
+                h.joinAsPlayer(client, gameState.ID, conn.PlayerNumber)
+
+                data := map[string]interface{}{
+                        "gameId":  gameState.ID,
+                        "player1": gameState.Player1,
+                        "player2": gameState.Player2,
+                        "rules":   gameState.Rules,
+                        "rated":   gameState.Rated,
+                        "hints":   gameState.HintsAllowed(),
+                        "yourTurn": conn.PlayerNumber == gameState.CurrentTurn,
+                        "resumeToken": h.issueResumeToken(gameState.ID, client.Username, conn.PlayerNumber),
+                }
+                if gameState.TimeControl.Enabled() {
+                        data["timeControl"] = gameState.TimeControl
+                        data["clocks"] = gameState.ClockMillis(time.Now())
+                }
+                if gameState.PreviousGameID != "" {
+                        data["previousGameId"] = gameState.PreviousGameID
+                        data["series"] = series
+                }
+                response := Message{Type: "game_start", Data: data}
+                responseBytes, _ := json.Marshal(response)
+                select {
+                case client.Send <- responseBytes:
+                default:
                 }
         }
+        h.mu.Unlock()
+        started := gameState.Clone()
+        unlock()
 
-        if h.onGameEvent != nil {
-                h.onGameEvent("game_started", gameState)
+        for _, gameID := range watched {
+                h.sendSpectatorCount(gameID)
         }
-}
 
-func (h *Hub) HandleJoin(client *Client, username string) {
-        client.Username = username
+        h.emit("game_started", started.ID, started)
+}
 
-        conn := &matchmaking.ClientConnection{
-                ID:       client.ID,
-                Username: username,
+// HandleJoin queues a player. botName picks the registered bot they face if
+// nobody else joins in time; when empty, negamax plays at the given
+// difficulty.
+func (h *Hub) HandleJoin(client *Client, username, variant, difficulty, botName, timeControl string) {
+        conn, err := h.newConnection(client, username, variant, difficulty, botName, timeControl)
+        if err != nil {
+                h.sendError(client, err.Error())
+                return
         }
 
+        h.matchmaker.CloseRooms(client.ID)
         h.matchmaker.AddToQueue(conn)
 
-        response := Message{
+        h.sendToClient(client, Message{
                 Type: "waiting",
                 Data: map[string]string{"message": "Waiting for opponent..."},
+        })
+}
+
+// HandleChallenge starts a game against a registered bot right away.
+func (h *Hub) HandleChallenge(client *Client, username, variant, difficulty, botName, timeControl string) {
+        conn, err := h.newConnection(client, username, variant, difficulty, botName, timeControl)
+        if err != nil {
+                h.sendError(client, err.Error())
+                return
         }
-        responseBytes, _ := json.Marshal(response)
-        client.Send <- responseBytes
+
+        h.matchmaker.ChallengeBot(conn)
+}
+
+// newConnection describes a player to the matchmaker. An empty
+// timeControl selects the server's default clock. A client already playing
+// a game cannot look for another, which would leave the first one hanging.
+func (h *Hub) newConnection(client *Client, username, variant, difficulty, botName, timeControl string) (*matchmaking.ClientConnection, error) {
+        if h.playing(client) {
+                return nil, errors.New("finish your game before starting another")
+        }
+
+        rules, err := game.ParseVariant(variant)
+        if err != nil {
+                return nil, err
+        }
+
+        clock := h.timeControl
+        if timeControl != "" {
+                clock, err = game.ParseTimeControl(timeControl)
+                if err != nil {
+                        return nil, err
+                }
+        }
+
+        conn := &matchmaking.ClientConnection{
+                ID:          client.ID,
+                Username:    username,
+                Rules:       rules,
+                TimeControl: clock,
+        }
+
+        if botName == "" {
+                botName = difficulty
+        }
+        if botName != "" {
+                conn.Bot, err = bot.ParseBot(botName)
+                if err != nil {
+                        return nil, err
+                }
+        }
+
+        client.Username = username
+        return conn, nil
 }
 
 func (h *Hub) HandleMove(client *Client, column int) {
-        gameState, exists := h.matchmaker.GetGameByPlayer(client.Username)
-        if !exists {
-                h.sendError(client, "No active game found")
+        h.handlePlayerMove(client, game.MoveDrop, column)
+}
+
+func (h *Hub) HandlePop(client *Client, column int) {
+        h.handlePlayerMove(client, game.MovePop, column)
+}
+
+func (h *Hub) handlePlayerMove(client *Client, kind game.MoveKind, column int) {
+        gameState, playerNumber, unlock, ok := h.activeGame(client)
+        if !ok {
                 return
         }
 
-        if gameState.IsFinished {
-                h.sendError(client, "Game is already finished")
+        if !h.playMove(client, gameState, playerNumber, kind, column) {
+                unlock()
                 return
         }
+        botToMove := gameState.Bot != "" && !gameState.IsFinished && gameState.CurrentTurn == game.Player2
+        unlock()
 
-        playerNumber := game.Player1
-        if gameState.Player1 == client.Username {
-                playerNumber = game.Player1
-        } else if gameState.Player2 == client.Username {
-                playerNumber = game.Player2
+        if botToMove {
+                go h.handleBotMove(gameState)
         }
+}
 
+// playMove makes a player's move and reports whether it was played. The
+// caller must hold the game's lock.
+func (h *Hub) playMove(client *Client, gameState *game.GameState, playerNumber game.Player, kind game.MoveKind, column int) bool {
         if gameState.CurrentTurn != playerNumber {
                 h.sendError(client, "Not your turn")
-                return
+                return false
+        }
+
+        now := time.Now()
+        if gameState.TimeControl.Enabled() && gameState.TimeLeft(playerNumber, now) <= 0 {
+                h.handleGameEnd(gameState, playerNumber.Opponent(), false, game.ReasonTimeout)
+                return false
         }
 
-        move, err := game.MakeMove(&gameState.Board, column, playerNumber)
+        move, err := game.ApplyMove(&gameState.Board, gameState.Rules, kind, column, playerNumber)
         if err != nil {
                 h.sendError(client, err.Error())
-                return
+                return false
+        }
+        gameState.RecordMove(move, client.Username)
+        gameState.PunchClock(playerNumber, now)
+        // Moving instead of answering a draw offer declines it.
+        if gameState.DrawOffer == playerNumber.Opponent() {
+                gameState.DrawOffer = game.Empty
         }
 
         gameState.CurrentTurn = game.Player1
@@ -201,51 +399,107 @@ func (h *Hub) HandleMove(client *Client, column int) {
 
         h.broadcastMove(gameState, move)
 
-        if h.onGameEvent != nil {
-                h.onGameEvent("move_made", map[string]interface{}{
-                        "gameId": gameState.ID,
-                        "player": client.Username,
-                        "move":   move,
-                })
-        }
+        h.emit("move_made", gameState.ID, map[string]interface{}{
+                "gameId": gameState.ID,
+                "player": client.Username,
+                "move":   *move,
+        })
 
-        winner, isDraw := game.CheckWinner(&gameState.Board)
+        winner, isDraw, reason := gameState.Outcome(playerNumber)
         if winner != game.Empty || isDraw {
-                h.handleGameEnd(gameState, winner, isDraw)
+                h.handleGameEnd(gameState, winner, isDraw, reason)
+        }
+        return true
+}
+
+// handleBotMove asks the game's bot for its move and plays it. It runs in
+// its own goroutine, off the player's read loop, and the game is not locked
+// while the bot thinks, so the player can still resign or chat; the move is
+// dropped if the game has moved on in the meantime.
+func (h *Hub) handleBotMove(gameState *game.GameState) {
+        unlock := h.matchmaker.LockGame(gameState.ID)
+        if gameState.IsFinished || gameState.CurrentTurn != game.Player2 {
+                unlock()
+                return
+        }
+        strategy, ok := bot.Bots.Lookup(gameState.Bot)
+        if !ok {
+                log.Printf("Bot %q of game %s is no longer registered, forfeiting", gameState.Bot, gameState.ID)
+                h.handleGameEnd(gameState, game.Player1, false, game.ReasonDisconnect)
+                unlock()
                 return
         }
+        board := gameState.Board.Clone()
+        ply := len(gameState.Moves)
+        timeout := botMoveTimeout
+        if gameState.TimeControl.Enabled() {
+                timeout = min(timeout, gameState.TimeLeft(game.Player2, time.Now()))
+        }
+        unlock()
+
+        ctx, cancel := context.WithTimeout(context.Background(), timeout)
+        defer cancel()
+        botKind, botColumn := strategy.SelectMove(ctx, &board, gameState.Rules, game.Player2)
 
-        // Bot's turn
-        if gameState.Player2 == bot.BotUsername && gameState.CurrentTurn == game.Player2 {
-                h.handleBotMove(gameState)
+        unlock = h.matchmaker.LockGame(gameState.ID)
+        defer unlock()
+
+        // The game may have ended, for instance by resignation or on the
+        // bot's clock, while the bot was thinking.
+        now := time.Now()
+        if gameState.IsFinished || len(gameState.Moves) != ply {
+                return
+        }
+        if gameState.TimeControl.Enabled() && gameState.TimeLeft(game.Player2, now) <= 0 {
+                h.handleGameEnd(gameState, game.Player1, false, game.ReasonTimeout)
+                return
         }
-}
 
-func (h *Hub) handleBotMove(gameState *game.GameState) {
-        botColumn := bot.SelectBotMove(&gameState.Board, game.Player2)
-        move, _ := game.MakeMove(&gameState.Board, botColumn, game.Player2)
+        move, err := game.ApplyMove(&gameState.Board, gameState.Rules, botKind, botColumn, game.Player2)
+        if err != nil {
+                // Remote bots return an invalid move when they miss the
+                // deadline or disconnect; anything else is a bad move.
+                reason := game.ReasonIllegalMove
+                if ctx.Err() == context.DeadlineExceeded {
+                        reason = game.ReasonTimeout
+                } else if remote, ok := strategy.(*RemoteBot); ok && remote.isClosed() {
+                        reason = game.ReasonDisconnect
+                }
+                log.Printf("Bot move failed in game %s, forfeiting (%s): %v", gameState.ID, reason, err)
+                h.handleGameEnd(gameState, game.Player1, false, reason)
+                return
+        }
+        gameState.RecordMove(move, gameState.Player2)
+        gameState.PunchClock(game.Player2, now)
 
         gameState.CurrentTurn = game.Player1
         h.matchmaker.UpdateGame(gameState.ID, gameState)
 
         h.broadcastMove(gameState, move)
 
-        if h.onGameEvent != nil {
-                h.onGameEvent("move_made", map[string]interface{}{
-                        "gameId": gameState.ID,
-                        "player": bot.BotUsername,
-                        "move":   move,
-                })
-        }
+        h.emit("move_made", gameState.ID, map[string]interface{}{
+                "gameId": gameState.ID,
+                "player": gameState.Player2,
+                "move":   *move,
+        })
 
-        winner, isDraw := game.CheckWinner(&gameState.Board)
+        winner, isDraw, reason := gameState.Outcome(game.Player2)
         if winner != game.Empty || isDraw {
-                h.handleGameEnd(gameState, winner, isDraw)
+                h.handleGameEnd(gameState, winner, isDraw, reason)
         }
 }
 
-func (h *Hub) handleGameEnd(gameState *game.GameState, winner game.Player, isDraw bool) {
+// handleGameEnd finishes a game and tells its room. A game only ends once:
+// whichever of a move, the clock, a resignation or a disconnection gets
+// there first decides the result. The caller must hold the game's lock.
+func (h *Hub) handleGameEnd(gameState *game.GameState, winner game.Player, isDraw bool, reason string) {
+        if gameState.IsFinished {
+                return
+        }
         gameState.IsFinished = true
+        gameState.FinishedAt = time.Now().UTC()
+        gameState.Reason = reason
+        gameState.DrawOffer = game.Empty
 
         if isDraw {
                 gameState.Winner = "Draw"
@@ -255,53 +509,202 @@ func (h *Hub) handleGameEnd(gameState *game.GameState, winner game.Player, isDra
                 gameState.Winner = gameState.Player2
         }
 
+        if reason == game.ReasonConnectFour {
+                gameState.WinningLine = game.WinningCells(&gameState.Board, gameState.Rules, winner)
+        }
+
         h.matchmaker.UpdateGame(gameState.ID, gameState)
 
-        response := Message{
-                Type: "game_over",
-                Data: map[string]interface{}{
-                        "winner": gameState.Winner,
-                },
+        h.mu.Lock()
+        h.dropResumeTokens(gameState.ID, game.Empty)
+        h.mu.Unlock()
+
+        data := map[string]interface{}{
+                "winner":      gameState.Winner,
+                "reason":      gameState.Reason,
+                "winningLine": gameState.WinningLine,
+        }
+        if gameState.PreviousGameID != "" {
+                data["series"] = h.matchmaker.Series(gameState)
         }
+        response := Message{Type: "game_over", Data: data}
         responseBytes, _ := json.Marshal(response)
+        h.sendToGame(gameState.ID, responseBytes)
 
-        h.mu.RLock()
-        for client := range h.clients {
-                if client.Username == gameState.Player1 || client.Username == gameState.Player2 {
-                        select {
-                        case client.Send <- responseBytes:
-                        default:
-                        }
-                }
+        // Listeners save the game, so they get a copy of it as it ended.
+        h.emit("game_ended", gameState.ID, gameState.Clone())
+}
+
+func (h *Hub) broadcastMove(gameState *game.GameState, move *game.Move) {
+        data := map[string]interface{}{
+                "ply":    move.Ply,
+                "kind":   move.Kind,
+                "row":    move.Row,
+                "column": move.Column,
+                "player": move.Player,
+        }
+        if gameState.TimeControl.Enabled() {
+                data["clocks"] = gameState.ClockMillis(time.Now())
+        }
+        response := Message{Type: "move", Data: data}
+        responseBytes, _ := json.Marshal(response)
+        h.sendToGame(gameState.ID, responseBytes)
+}
+
+// HandleHint analyzes the position for a player whose turn it is. Hints are
+// refused in rated games between two people so they cannot be used against
+// another person.
+// The analysis runs in the background, one per client at a time, so that
+// the client's other messages are not held up; a hint is dropped if the
+// game has moved on by the time it is ready.
+func (h *Hub) HandleHint(client *Client) {
+        gameState, playerNumber, unlock, ok := h.activeGame(client)
+        if !ok {
+                return
+        }
+        allowed, toMove, board, ply := gameState.HintsAllowed(), gameState.CurrentTurn, gameState.Board.Clone(), len(gameState.Moves)
+        unlock()
+
+        if !allowed {
+                h.sendError(client, "Hints are disabled in rated games")
+                return
         }
-        h.mu.RUnlock()
 
-        if h.onGameEvent != nil {
-                h.onGameEvent("game_ended", gameState)
+        if toMove != playerNumber {
+                h.sendError(client, "Not your turn")
+                return
         }
+
+        h.mu.Lock()
+        busy := client.hinting
+        client.hinting = true
+        h.mu.Unlock()
+        if busy {
+                h.sendError(client, "A hint is already on its way")
+                return
+        }
+
+        go func() {
+                defer func() {
+                        h.mu.Lock()
+                        client.hinting = false
+                        h.mu.Unlock()
+                }()
+
+                analysis, err := bot.AnalyzePosition(context.Background(), &board, gameState.Rules, playerNumber)
+                if err != nil {
+                        h.sendError(client, err.Error())
+                        return
+                }
+
+                unlock := h.matchmaker.LockGame(gameState.ID)
+                current := !gameState.IsFinished && len(gameState.Moves) == ply
+                unlock()
+                if current {
+                        h.sendToClient(client, Message{
+                                Type: "hint",
+                                Data: analysis,
+                        })
+                }
+        }()
 }
 
-func (h *Hub) broadcastMove(gameState *game.GameState, move *game.Move) {
-        response := Message{
-                Type: "move",
+func (h *Hub) HandleReplay(client *Client, gameID string, speed float64) {
+        gameState, err := h.loadGame(gameID)
+        if err != nil {
+                h.sendError(client, err.Error())
+                return
+        }
+        if speed <= 0 {
+                speed = 1
+        }
+
+        go h.streamReplay(client, gameState, speed)
+}
+
+// streamReplay sends the recorded moves of a game one by one, spacing them
+// by the original think time divided by speed.
+func (h *Hub) streamReplay(client *Client, gameState *game.GameState, speed float64) {
+        moves := append([]game.Move(nil), gameState.Moves...)
+
+        start := Message{
+                Type: "replay_start",
                 Data: map[string]interface{}{
-                        "row":    move.Row,
-                        "column": move.Column,
-                        "player": move.Player,
+                        "gameId":     gameState.ID,
+                        "player1":    gameState.Player1,
+                        "player2":    gameState.Player2,
+                        "totalMoves": len(moves),
+                        "speed":      speed,
                 },
         }
-        responseBytes, _ := json.Marshal(response)
+        if !h.sendToClient(client, start) {
+                return
+        }
 
-        h.mu.RLock()
-        for client := range h.clients {
-                if client.Username == gameState.Player1 || client.Username == gameState.Player2 {
-                        select {
-                        case client.Send <- responseBytes:
-                        default:
-                        }
+        for i, move := range moves {
+                delay := time.Second
+                if i > 0 && !move.Timestamp.IsZero() && !moves[i-1].Timestamp.IsZero() {
+                        delay = move.Timestamp.Sub(moves[i-1].Timestamp)
+                }
+                delay = time.Duration(float64(delay) / speed)
+                if delay > maxReplayDelay {
+                        delay = maxReplayDelay
+                }
+                time.Sleep(delay)
+
+                response := Message{
+                        Type: "replay_move",
+                        Data: map[string]interface{}{
+                                "gameId":    gameState.ID,
+                                "ply":       move.Ply,
+                                "kind":      move.Kind,
+                                "row":       move.Row,
+                                "column":    move.Column,
+                                "player":    move.Player,
+                                "username":  move.Username,
+                                "timestamp": move.Timestamp,
+                        },
+                }
+                if !h.sendToClient(client, response) {
+                        return
                 }
         }
-        h.mu.RUnlock()
+
+        end := Message{
+                Type: "replay_end",
+                Data: map[string]interface{}{
+                        "gameId":     gameState.ID,
+                        "winner":     gameState.Winner,
+                        "isFinished": gameState.IsFinished,
+                },
+        }
+        h.sendToClient(client, end)
+}
+
+// sendToClient delivers a message to a client that may have been unregistered
+// in the meantime. It reports false once the client is gone.
+func (h *Hub) sendToClient(client *Client, message Message) bool {
+        responseBytes, _ := json.Marshal(message)
+        return h.sendBytes(client, responseBytes)
+}
+
+// sendBytes is sendToClient for a message that is already encoded. Every
+// send to a single client goes through here: a client's Send channel is
+// closed when it is removed, which can happen at any time, for instance
+// when the player resumes on another connection, and only the check under
+// h.mu makes the send safe.
+func (h *Hub) sendBytes(client *Client, message []byte) bool {
+        h.mu.RLock()
+        defer h.mu.RUnlock()
+
+        if _, ok := h.clients[client]; !ok || client.Disconnected {
+                return false
+        }
+        select {
+        case client.Send <- message:
+        default:
+        }
+        return true
 }
 
 func (h *Hub) sendError(client *Client, message string) {
@@ -310,63 +713,29 @@ func (h *Hub) sendError(client *Client, message string) {
                 "error": message,
         }
         responseBytes, _ := json.Marshal(response)
-        client.Send <- responseBytes
+        h.sendBytes(client, responseBytes)
 }
 
 func (h *Hub) handleDisconnectionTimeout(client *Client) {
         time.Sleep(30 * time.Second)
 
         h.mu.Lock()
-        defer h.mu.Unlock()
-
-        if _, stillExists := h.clients[client]; !stillExists {
+        if _, stillExists := h.clients[client]; !stillExists || !client.Disconnected {
+                h.mu.Unlock()
                 return
         }
+        log.Printf("Player %s did not reconnect within 30 seconds, forfeiting game", client.Username)
+        gameID, player := client.GameID, client.PlayerNumber
+        h.removeClient(client)
+        h.mu.Unlock()
 
-        if client.Disconnected {
-                log.Printf("Player %s did not reconnect within 30 seconds, forfeiting game", client.Username)
-                
-                gameState, exists := h.matchmaker.GetGameByPlayer(client.Username)
-                if exists && !gameState.IsFinished {
-                        var opponent string
-                        if gameState.Player1 == client.Username {
-                                opponent = gameState.Player2
-                        } else {
-                                opponent = gameState.Player1
-                        }
-
-                        gameState.IsFinished = true
-                        gameState.Winner = opponent
-                        h.matchmaker.UpdateGame(gameState.ID, gameState)
-
-                        response := Message{
-                                Type: "game_over",
-                                Data: map[string]interface{}{
-                                        "winner": opponent,
-                                        "reason": "opponent_disconnected",
-                                },
-                        }
-                        responseBytes, _ := json.Marshal(response)
-
-                        for c := range h.clients {
-                                if c.Username == opponent && !c.Disconnected {
-                                        select {
-                                        case c.Send <- responseBytes:
-                                        default:
-                                        }
-                                }
-                        }
-
-                        if h.onGameEvent != nil {
-                                h.onGameEvent("game_ended", gameState)
-                        }
-                }
-
-                delete(h.clients, client)
-                if client.Send != nil {
-                        close(client.Send)
-                }
+        gameState, exists := h.matchmaker.GetGame(gameID)
+        if !exists {
+                return
         }
+        unlock := h.matchmaker.LockGame(gameID)
+        defer unlock()
+        h.handleGameEnd(gameState, player.Opponent(), false, game.ReasonDisconnect)
 }
 
 func (c *Client) ReadPump() {
@@ -389,9 +758,53 @@ func (c *Client) ReadPump() {
 
                 switch msg.Type {
                 case "join":
-                        c.Hub.HandleJoin(c, msg.Username)
+                        c.Hub.HandleJoin(c, msg.Username, msg.Variant, msg.Difficulty, msg.Bot, msg.TimeControl)
+                case "bot_auth":
+                        c.Hub.HandleBotAuth(c, msg.Username, msg.APIKey)
+                case "bot_move":
+                        c.Hub.HandleBotMove(c, msg)
+                case "challenge":
+                        c.Hub.HandleChallenge(c, msg.Username, msg.Variant, msg.Difficulty, msg.Bot, msg.TimeControl)
                 case "move":
                         c.Hub.HandleMove(c, msg.Column)
+                case "pop":
+                        c.Hub.HandlePop(c, msg.Column)
+                case "replay":
+                        c.Hub.HandleReplay(c, msg.GameID, msg.Speed)
+                case "hint":
+                        c.Hub.HandleHint(c)
+                case "rematch_offer":
+                        c.Hub.HandleRematchOffer(c)
+                case "rematch_accept":
+                        c.Hub.HandleRematchAccept(c)
+                case "rematch_decline":
+                        c.Hub.HandleRematchDecline(c)
+                case "resign":
+                        c.Hub.HandleResign(c)
+                case "offer_draw":
+                        c.Hub.HandleOfferDraw(c)
+                case "accept_draw":
+                        c.Hub.HandleAcceptDraw(c)
+                case "decline_draw":
+                        c.Hub.HandleDeclineDraw(c)
+                case "resume":
+                        c.Hub.HandleResume(c, msg.Token)
+                case "spectate":
+                        c.Hub.HandleSpectate(c, msg.GameID)
+                case "stop_spectating":
+                        c.Hub.HandleStopSpectating(c)
+                case "chat":
+                        c.Hub.HandleChat(c, msg.Text)
+                case "reaction":
+                        c.Hub.HandleReaction(c, msg.Reaction)
+                case "mute":
+                        c.Hub.HandleMute(c, msg.Username)
+                case "unmute":
+                        c.Hub.HandleUnmute(c, msg.Username)
+                case "create_room":
+                        c.Hub.HandleCreateRoom(c, msg.Username, msg.Variant, msg.First, msg.TimeControl)
+                case "join_room":
+                        c.Hub.HandleJoinRoom(c, msg.Username, msg.Code)
                 }
         }
 }
@@ -416,7 +829,4 @@ func ServeWS(hub *Hub, conn *websocket.Conn) {
         }
 
         hub.register <- client
-
-        go client.WritePump()
-        go client.ReadPump()
 }
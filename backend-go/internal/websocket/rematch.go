@@ -0,0 +1,122 @@
+package websocket
+
+import (
+        "fourinrow/internal/game"
+        "fourinrow/internal/matchmaking"
+        "time"
+)
+
+// HandleRematchOffer offers the opponent of the client's last game a
+// rematch. If the opponent offered one too, the rematch starts.
+func (h *Hub) HandleRematchOffer(client *Client) {
+        gameState, opponent, ok := h.rematchGame(client)
+        if !ok {
+                return
+        }
+
+        expired := func() {
+                for _, player := range []game.Player{game.Player1, game.Player2} {
+                        if c := h.seat(gameState.ID, player); c != nil {
+                                h.sendToClient(c, Message{
+                                        Type: "rematch_expired",
+                                        Data: map[string]interface{}{"gameId": gameState.ID},
+                                })
+                        }
+                }
+        }
+        agreed, err := h.matchmaker.OfferRematch(gameState.ID, client.Username, expired)
+        if err != nil {
+                h.sendError(client, err.Error())
+                return
+        }
+        if agreed {
+                h.startRematch(gameState)
+                return
+        }
+
+        h.sendToClient(opponent, Message{
+                Type: "rematch_offered",
+                Data: map[string]interface{}{
+                        "gameId":    gameState.ID,
+                        "from":      client.Username,
+                        "expiresAt": time.Now().Add(matchmaking.RematchTimeout).UTC(),
+                },
+        })
+}
+
+// HandleRematchAccept starts the rematch the opponent offered.
+func (h *Hub) HandleRematchAccept(client *Client) {
+        gameState, _, ok := h.rematchGame(client)
+        if !ok {
+                return
+        }
+        if _, err := h.matchmaker.AnswerRematch(gameState.ID, client.Username); err != nil {
+                h.sendError(client, err.Error())
+                return
+        }
+        h.startRematch(gameState)
+}
+
+// HandleRematchDecline turns down the opponent's rematch offer.
+func (h *Hub) HandleRematchDecline(client *Client) {
+        gameState, opponent, ok := h.rematchGame(client)
+        if !ok {
+                return
+        }
+        if _, err := h.matchmaker.AnswerRematch(gameState.ID, client.Username); err != nil {
+                h.sendError(client, err.Error())
+                return
+        }
+        h.sendToClient(opponent, Message{
+                Type: "rematch_declined",
+                Data: map[string]interface{}{"gameId": gameState.ID},
+        })
+}
+
+// rematchGame finds the finished game a client can ask to replay and the
+// opponent's connection, sending the client an error if there is none.
+func (h *Hub) rematchGame(client *Client) (*game.GameState, *Client, bool) {
+        gameState, player, exists := h.seatedGame(client)
+        if !exists {
+                h.sendError(client, "No game to rematch")
+                return nil, nil, false
+        }
+        unlock := h.matchmaker.LockGame(gameState.ID)
+        finished := gameState.IsFinished
+        unlock()
+        if !finished {
+                h.sendError(client, "Game is still in progress")
+                return nil, nil, false
+        }
+        if gameState.Bot != "" {
+                h.sendError(client, "Challenge the bot again to play it another game")
+                return nil, nil, false
+        }
+
+        // Players leave the room when they start another game.
+        opponent := h.seat(gameState.ID, player.Opponent())
+        if opponent == nil {
+                h.sendError(client, "Your opponent has left or started another game")
+                return nil, nil, false
+        }
+        return gameState, opponent, true
+}
+
+// startRematch creates the rematch of previous with colors swapped.
+func (h *Hub) startRematch(previous *game.GameState) {
+        player1 := h.seat(previous.ID, game.Player2)
+        player2 := h.seat(previous.ID, game.Player1)
+        if player1 == nil || player2 == nil {
+                for _, c := range []*Client{player1, player2} {
+                        if c != nil {
+                                h.sendError(c, "Your opponent has left")
+                        }
+                }
+                return
+        }
+
+        h.matchmaker.StartRematch(previous,
+                &matchmaking.ClientConnection{ID: player1.ID, Username: player1.Username},
+                &matchmaking.ClientConnection{ID: player2.ID, Username: player2.Username},
+        )
+}
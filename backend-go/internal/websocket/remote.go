@@ -0,0 +1,205 @@
+package websocket
+
+import (
+        "context"
+        "crypto/subtle"
+        "errors"
+        "fourinrow/internal/bot"
+        "fourinrow/internal/game"
+        "log"
+        "sync"
+        "time"
+
+        "github.com/google/uuid"
+)
+
+// RemoteBot is a bot strategy played by a client connected to /ws. For each
+// move it sends the client a your_turn message with a request ID, the full
+// position and the deadline, and waits for a bot_move message carrying the
+// same request ID. A bot that does not answer in time forfeits the game.
+type RemoteBot struct {
+        name   string
+        client *Client
+        hub    *Hub
+
+        mu      sync.Mutex
+        pending map[string]chan Message
+        closed  bool
+}
+
+func newRemoteBot(hub *Hub, client *Client, name string) *RemoteBot {
+        return &RemoteBot{
+                name:    name,
+                client:  client,
+                hub:     hub,
+                pending: make(map[string]chan Message),
+        }
+}
+
+func (r *RemoteBot) Name() string {
+        return r.name
+}
+
+func (r *RemoteBot) Description() string {
+        return "Remote bot connected over WebSocket"
+}
+
+// OnLeaderboard reports that remote bots keep stats under their own name.
+func (r *RemoteBot) OnLeaderboard() bool {
+        return true
+}
+
+// SelectMove asks the remote client for a move. It returns column -1, which
+// the hub treats as a forfeit, if no legal answer arrives before ctx is done
+// or the client disconnects.
+func (r *RemoteBot) SelectMove(ctx context.Context, board *game.Board, rules game.Rules, botPlayer game.Player) (game.MoveKind, int) {
+        requestID := uuid.New().String()
+        reply := make(chan Message, 1)
+
+        r.mu.Lock()
+        if r.closed {
+                r.mu.Unlock()
+                return game.MoveDrop, -1
+        }
+        r.pending[requestID] = reply
+        r.mu.Unlock()
+
+        defer func() {
+                r.mu.Lock()
+                delete(r.pending, requestID)
+                r.mu.Unlock()
+        }()
+
+        data := map[string]interface{}{
+                "requestId": requestID,
+                "board":     board,
+                "rules":     rules,
+                "player":    botPlayer,
+        }
+        if deadline, ok := ctx.Deadline(); ok {
+                data["deadline"] = deadline.UTC()
+                data["timeoutMs"] = time.Until(deadline).Milliseconds()
+        }
+        if !r.hub.sendToClient(r.client, Message{Type: "your_turn", Data: data}) {
+                return game.MoveDrop, -1
+        }
+
+        for {
+                select {
+                case msg, ok := <-reply:
+                        if !ok {
+                                return game.MoveDrop, -1
+                        }
+                        kind := game.MoveKind(msg.Kind)
+                        if kind == "" {
+                                kind = game.MoveDrop
+                        }
+                        valid := game.IsValidMove(board, msg.Column)
+                        if kind == game.MovePop {
+                                valid = rules.PopOut && game.IsValidPop(board, msg.Column, botPlayer)
+                        }
+                        if valid {
+                                return kind, msg.Column
+                        }
+                        r.hub.sendError(r.client, "Illegal move, try again")
+                case <-ctx.Done():
+                        log.Printf("Remote bot %s missed its move deadline", r.name)
+                        return game.MoveDrop, -1
+                }
+        }
+}
+
+// deliver hands a bot_move message to the move request it answers.
+func (r *RemoteBot) deliver(msg Message) error {
+        r.mu.Lock()
+        defer r.mu.Unlock()
+
+        reply, ok := r.pending[msg.RequestID]
+        if !ok {
+                return errors.New("no move was requested with that ID")
+        }
+        select {
+        case reply <- msg:
+        default:
+        }
+        return nil
+}
+
+// isClosed reports whether the client playing the bot has gone.
+func (r *RemoteBot) isClosed() bool {
+        r.mu.Lock()
+        defer r.mu.Unlock()
+        return r.closed
+}
+
+// close fails every outstanding move request once the client has gone.
+func (r *RemoteBot) close() {
+        r.mu.Lock()
+        defer r.mu.Unlock()
+
+        r.closed = true
+        for requestID, reply := range r.pending {
+                close(reply)
+                delete(r.pending, requestID)
+        }
+}
+
+// SetBotAPIKeys sets the keys remote bots authenticate with, by bot name.
+func (h *Hub) SetBotAPIKeys(keys map[string]string) {
+        h.botAPIKeys = keys
+}
+
+// HandleBotAuth turns a client into a remote bot if name and apiKey match
+// a configured key. The bot is registered under its name and offered to
+// players who time out of the queue until it disconnects.
+func (h *Hub) HandleBotAuth(client *Client, name, apiKey string) {
+        key, ok := h.botAPIKeys[name]
+        if !ok || subtle.ConstantTimeCompare([]byte(key), []byte(apiKey)) != 1 {
+                h.sendError(client, "Invalid bot credentials")
+                return
+        }
+        if client.RemoteBot != nil {
+                h.sendError(client, "Already registered as a bot")
+                return
+        }
+        if existing, exists := bot.Bots.Lookup(name); exists {
+                if _, remote := existing.(*RemoteBot); !remote {
+                        h.sendError(client, "A built-in bot already uses that name")
+                        return
+                }
+        }
+
+        remote := newRemoteBot(h, client, name)
+        client.Username = name
+        client.RemoteBot = remote
+        bot.Bots.Register(remote)
+        h.matchmaker.AddRemoteBot(remote)
+        log.Printf("Remote bot %s connected", name)
+
+        h.sendToClient(client, Message{
+                Type: "bot_registered",
+                Data: map[string]interface{}{"name": name},
+        })
+}
+
+// HandleBotMove passes a remote bot's answer to the move request it is for.
+func (h *Hub) HandleBotMove(client *Client, msg Message) {
+        if client.RemoteBot == nil {
+                h.sendError(client, "Only authenticated bots can send bot moves")
+                return
+        }
+        if err := client.RemoteBot.deliver(msg); err != nil {
+                h.sendError(client, err.Error())
+        }
+}
+
+// removeRemoteBot withdraws a disconnected remote bot. Games it is playing
+// are forfeited on its next turn.
+func (h *Hub) removeRemoteBot(remote *RemoteBot) {
+        if registered, ok := bot.Bots.Lookup(remote.name); ok && registered == bot.Strategy(remote) {
+                bot.Bots.Unregister(remote.name)
+        }
+        h.matchmaker.RemoveRemoteBot(remote)
+        remote.close()
+        log.Printf("Remote bot %s disconnected", remote.name)
+}
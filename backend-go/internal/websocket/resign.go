@@ -0,0 +1,115 @@
+package websocket
+
+import (
+        "fourinrow/internal/game"
+)
+
+// HandleResign ends the client's game as a loss.
+func (h *Hub) HandleResign(client *Client) {
+        gameState, player, unlock, ok := h.activeGame(client)
+        if !ok {
+                return
+        }
+        defer unlock()
+        h.handleGameEnd(gameState, player.Opponent(), false, game.ReasonResignation)
+}
+
+// HandleOfferDraw offers the opponent a draw. The offer stands until they
+// answer it or make a move; if they had offered one already, the game is
+// drawn. Bots always decline.
+func (h *Hub) HandleOfferDraw(client *Client) {
+        gameState, player, unlock, ok := h.activeGame(client)
+        if !ok {
+                return
+        }
+        defer unlock()
+
+        switch gameState.DrawOffer {
+        case player:
+                h.sendError(client, "You have already offered a draw")
+                return
+        case player.Opponent():
+                h.handleGameEnd(gameState, game.Empty, true, game.ReasonAgreement)
+                return
+        }
+
+        if gameState.Bot != "" {
+                h.sendToClient(client, Message{Type: "draw_declined"})
+                return
+        }
+
+        gameState.DrawOffer = player
+        h.matchmaker.UpdateGame(gameState.ID, gameState)
+        if opponent := h.seat(gameState.ID, player.Opponent()); opponent != nil {
+                h.sendToClient(opponent, Message{
+                        Type: "draw_offered",
+                        Data: map[string]interface{}{"from": client.Username},
+                })
+        }
+}
+
+// HandleAcceptDraw draws the game if the opponent offered a draw.
+func (h *Hub) HandleAcceptDraw(client *Client) {
+        gameState, player, unlock, ok := h.activeGame(client)
+        if !ok {
+                return
+        }
+        defer unlock()
+        if gameState.DrawOffer != player.Opponent() {
+                h.sendError(client, "No draw has been offered")
+                return
+        }
+        h.handleGameEnd(gameState, game.Empty, true, game.ReasonAgreement)
+}
+
+// HandleDeclineDraw turns down the opponent's draw offer.
+func (h *Hub) HandleDeclineDraw(client *Client) {
+        gameState, player, unlock, ok := h.activeGame(client)
+        if !ok {
+                return
+        }
+        defer unlock()
+        if gameState.DrawOffer != player.Opponent() {
+                h.sendError(client, "No draw has been offered")
+                return
+        }
+
+        gameState.DrawOffer = game.Empty
+        h.matchmaker.UpdateGame(gameState.ID, gameState)
+        if opponent := h.seat(gameState.ID, player.Opponent()); opponent != nil {
+                h.sendToClient(opponent, Message{Type: "draw_declined"})
+        }
+}
+
+// activeGame finds the unfinished game the client is seated in and which
+// player they are, sending the client an error if there is none. The game
+// is returned locked, so that nothing else can end it or move in it until
+// the caller is done with it and calls unlock.
+func (h *Hub) activeGame(client *Client) (*game.GameState, game.Player, func(), bool) {
+        gameState, player, ok := h.seatedGame(client)
+        if !ok {
+                h.sendError(client, "No active game found")
+                return nil, game.Empty, nil, false
+        }
+        unlock := h.matchmaker.LockGame(gameState.ID)
+        if gameState.IsFinished {
+                unlock()
+                h.sendError(client, "Game is already finished")
+                return nil, game.Empty, nil, false
+        }
+        return gameState, player, unlock, true
+}
+
+// seatedGame returns the game the client is seated in, finished or not,
+// and which player they are.
+func (h *Hub) seatedGame(client *Client) (*game.GameState, game.Player, bool) {
+        h.mu.RLock()
+        gameID, player := client.GameID, client.PlayerNumber
+        h.mu.RUnlock()
+
+        if gameID == "" {
+                return nil, game.Empty, false
+        }
+        gameState, exists := h.matchmaker.GetGame(gameID)
+        return gameState, player, exists
+}
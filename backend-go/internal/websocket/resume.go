@@ -0,0 +1,147 @@
+package websocket
+
+import (
+        "crypto/rand"
+        "encoding/hex"
+        "fourinrow/internal/game"
+        "log"
+        "time"
+)
+
+// resumeTokenLifetime is how long a resume token lasts even if its game
+// never ends.
+const resumeTokenLifetime = 24 * time.Hour
+
+// resumeSession is what a resume token stands for: one player's seat in
+// one game.
+type resumeSession struct {
+        gameID   string
+        username string
+        player   game.Player
+        expires  time.Time
+}
+
+// issueResumeToken creates the token a player sends in a resume message to
+// take their seat back after reconnecting, and forgets tokens that have
+// expired. The caller must hold h.mu.
+func (h *Hub) issueResumeToken(gameID, username string, player game.Player) string {
+        now := time.Now()
+        for token, session := range h.resumeTokens {
+                if now.After(session.expires) {
+                        delete(h.resumeTokens, token)
+                }
+        }
+
+        buf := make([]byte, 16)
+        if _, err := rand.Read(buf); err != nil {
+                log.Printf("Failed to create resume token: %v", err)
+                return ""
+        }
+        token := hex.EncodeToString(buf)
+        h.resumeTokens[token] = resumeSession{
+                gameID:   gameID,
+                username: username,
+                player:   player,
+                expires:  now.Add(resumeTokenLifetime),
+        }
+        return token
+}
+
+// dropResumeTokens forgets the tokens for player's seat in gameID, or for
+// every seat in it if player is Empty. The caller must hold h.mu.
+func (h *Hub) dropResumeTokens(gameID string, player game.Player) {
+        for token, session := range h.resumeTokens {
+                if session.gameID == gameID && (player == game.Empty || session.player == player) {
+                        delete(h.resumeTokens, token)
+                }
+        }
+}
+
+// HandleResume binds a new connection to the game and seat of a resume
+// token from game_start. The player's old connection is dropped, which
+// cancels the forfeit for disconnecting, and they are sent a game_state
+// snapshot to carry on from. Tokens only last while their game is in
+// progress; an unknown or expired token gets resume_failed.
+func (h *Hub) HandleResume(client *Client, token string) {
+        h.mu.RLock()
+        session, ok := h.resumeTokens[token]
+        h.mu.RUnlock()
+        gameState, exists := h.matchmaker.GetGame(session.gameID)
+        if !ok || token == "" || !exists || time.Now().After(session.expires) {
+                h.sendToClient(client, Message{Type: "resume_failed", Data: map[string]string{"error": "Invalid resume token"}})
+                return
+        }
+
+        h.mu.RLock()
+        elsewhere := client.GameID != session.gameID
+        h.mu.RUnlock()
+        if elsewhere && h.playing(client) {
+                h.sendToClient(client, Message{Type: "resume_failed", Data: map[string]string{"error": "Finish your game before resuming another"}})
+                return
+        }
+
+        unlock := h.matchmaker.LockGame(session.gameID)
+        defer unlock()
+
+        h.mu.Lock()
+        // The game may have ended, taking the token with it, in the
+        // meantime.
+        if _, ok := h.resumeTokens[token]; !ok {
+                h.mu.Unlock()
+                h.sendToClient(client, Message{Type: "resume_failed", Data: map[string]string{"error": "Invalid resume token"}})
+                return
+        }
+        if r, ok := h.rooms[session.gameID]; ok {
+                for old, seat := range r.players {
+                        if old != client && seat == session.player {
+                                if client.Muted == nil {
+                                        client.Muted = old.Muted
+                                }
+                                h.removeClient(old)
+                        }
+                }
+        }
+        client.Username = session.username
+        h.joinAsPlayer(client, session.gameID, session.player)
+        snapshot := gameSnapshot(gameState, session.player)
+        snapshot["spectators"] = h.spectatorCount(session.gameID)
+        h.mu.Unlock()
+
+        log.Printf("Player %s resumed game %s", session.username, session.gameID)
+        h.sendToClient(client, Message{Type: "game_state", Data: snapshot})
+
+        if opponent := h.seat(session.gameID, session.player.Opponent()); opponent != nil {
+                h.sendToClient(opponent, Message{Type: "opponent_reconnected"})
+        }
+}
+
+// gameSnapshot describes a game in full from player's point of view.
+func gameSnapshot(gameState *game.GameState, player game.Player) map[string]interface{} {
+        snapshot := map[string]interface{}{
+                "gameId":       gameState.ID,
+                "player1":      gameState.Player1,
+                "player2":      gameState.Player2,
+                "rules":        gameState.Rules,
+                "rated":        gameState.Rated,
+                "hints":        gameState.HintsAllowed(),
+                "board":        gameState.Board,
+                "currentTurn":  gameState.CurrentTurn,
+                "playerNumber": player,
+                "yourTurn":     !gameState.IsFinished && gameState.CurrentTurn == player,
+                "moves":        len(gameState.Moves),
+                "isFinished":   gameState.IsFinished,
+        }
+        if gameState.TimeControl.Enabled() {
+                snapshot["timeControl"] = gameState.TimeControl
+                snapshot["clocks"] = gameState.ClockMillis(time.Now())
+        }
+        if gameState.DrawOffer != game.Empty {
+                snapshot["drawOffer"] = gameState.DrawOffer
+        }
+        if gameState.IsFinished {
+                snapshot["winner"] = gameState.Winner
+                snapshot["reason"] = gameState.Reason
+                snapshot["winningLine"] = gameState.WinningLine
+        }
+        return snapshot
+}
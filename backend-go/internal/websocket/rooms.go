@@ -0,0 +1,63 @@
+package websocket
+
+import (
+        "fourinrow/internal/matchmaking"
+)
+
+// HandleCreateRoom opens a private room for the given variant and time
+// control and sends its code back. first says who moves first once someone
+// joins: the creator (the default), the guest or either at random.
+func (h *Hub) HandleCreateRoom(client *Client, username, variant, first, timeControl string) {
+        conn, err := h.newConnection(client, username, variant, "", "", timeControl)
+        if err != nil {
+                h.sendError(client, err.Error())
+                return
+        }
+
+        h.matchmaker.RemoveFromQueue(client.ID)
+        room, err := h.matchmaker.CreateRoom(conn, first)
+        if err != nil {
+                h.sendError(client, err.Error())
+                return
+        }
+
+        h.sendToClient(client, Message{
+                Type: "room_created",
+                Data: map[string]interface{}{
+                        "code":        room.Code,
+                        "rules":       conn.Rules,
+                        "timeControl": conn.TimeControl,
+                        "first":       room.First,
+                        "expiresAt":   room.ExpiresAt.UTC(),
+                },
+        })
+}
+
+// HandleJoinRoom starts the game in the room with the given code. Both
+// players then receive game_start as usual.
+func (h *Hub) HandleJoinRoom(client *Client, username, code string) {
+        conn, err := h.newConnection(client, username, "", "", "", "")
+        if err != nil {
+                h.sendError(client, err.Error())
+                return
+        }
+
+        h.matchmaker.RemoveFromQueue(client.ID)
+        h.matchmaker.CloseRooms(client.ID)
+        if _, err := h.matchmaker.JoinRoom(code, conn); err != nil {
+                h.sendError(client, err.Error())
+        }
+}
+
+func (h *Hub) handleRoomExpired(room *matchmaking.Room) {
+        h.mu.RLock()
+        creator, ok := h.clientsByID[room.Creator.ID]
+        h.mu.RUnlock()
+
+        if ok {
+                h.sendToClient(creator, Message{
+                        Type: "room_expired",
+                        Data: map[string]interface{}{"code": room.Code},
+                })
+        }
+}
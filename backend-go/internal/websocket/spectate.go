@@ -0,0 +1,126 @@
+package websocket
+
+import (
+        "encoding/json"
+        "fourinrow/internal/game"
+        "log"
+        "sort"
+        "time"
+)
+
+// LiveGame summarises a game in progress for the list of games that can be
+// watched.
+type LiveGame struct {
+        ID          string           `json:"id"`
+        Player1     string           `json:"player1"`
+        Player2     string           `json:"player2"`
+        Bot         string           `json:"bot,omitempty"`
+        Rules       game.Rules       `json:"rules"`
+        Rated       bool             `json:"rated"`
+        TimeControl game.TimeControl `json:"timeControl,omitzero"`
+        Moves       int              `json:"moves"`
+        Spectators  int              `json:"spectators"`
+        CreatedAt   time.Time        `json:"createdAt"`
+}
+
+// LiveGames lists the games in progress, newest first.
+func (h *Hub) LiveGames() []LiveGame {
+        games := []LiveGame{}
+        for _, gameState := range h.matchmaker.GetAllGames() {
+                unlock := h.matchmaker.LockGame(gameState.ID)
+                if !gameState.IsFinished {
+                        games = append(games, LiveGame{
+                                ID:          gameState.ID,
+                                Player1:     gameState.Player1,
+                                Player2:     gameState.Player2,
+                                Bot:         gameState.Bot,
+                                Rules:       gameState.Rules,
+                                Rated:       gameState.Rated,
+                                TimeControl: gameState.TimeControl,
+                                Moves:       len(gameState.Moves),
+                                CreatedAt:   gameState.CreatedAt,
+                        })
+                }
+                unlock()
+        }
+
+        h.mu.RLock()
+        for i := range games {
+                games[i].Spectators = h.spectatorCount(games[i].ID)
+        }
+        h.mu.RUnlock()
+
+        sort.Slice(games, func(i, j int) bool { return games[i].CreatedAt.After(games[j].CreatedAt) })
+        return games
+}
+
+// HandleSpectate adds a client to the room of a game in progress. They are
+// sent a spectate_start snapshot to catch up with and then the game's moves
+// and its game_over, and the players are told how many people are
+// watching.
+func (h *Hub) HandleSpectate(client *Client, gameID string) {
+        if h.playing(client) {
+                h.sendError(client, "Finish your game before watching another")
+                return
+        }
+
+        gameState, exists := h.matchmaker.GetGame(gameID)
+        if !exists {
+                h.sendError(client, "Game not found")
+                return
+        }
+        // Holding the game's lock while joining the room means no move
+        // can fall between the snapshot and the spectator's first move
+        // message.
+        unlock := h.matchmaker.LockGame(gameID)
+        if gameState.IsFinished {
+                unlock()
+                h.sendError(client, "Game is already finished")
+                return
+        }
+
+        h.mu.Lock()
+        previous := client.Spectating
+        h.joinAsSpectator(client, gameID)
+        snapshot := gameSnapshot(gameState, game.Empty)
+        snapshot["spectators"] = h.spectatorCount(gameID)
+        h.mu.Unlock()
+        h.sendToClient(client, Message{Type: "spectate_start", Data: snapshot})
+        unlock()
+
+        log.Printf("Client %s is spectating game %s", client.ID, gameID)
+
+        if previous != "" && previous != gameID {
+                h.sendSpectatorCount(previous)
+        }
+        h.sendSpectatorCount(gameID)
+}
+
+// HandleStopSpectating takes a client out of the room of the game it is
+// watching.
+func (h *Hub) HandleStopSpectating(client *Client) {
+        h.mu.Lock()
+        gameID := h.leaveAsSpectator(client)
+        h.mu.Unlock()
+
+        if gameID != "" {
+                h.sendSpectatorCount(gameID)
+        }
+}
+
+// sendSpectatorCount tells the players of a game in progress how many
+// people are watching it.
+func (h *Hub) sendSpectatorCount(gameID string) {
+        gameState, exists := h.matchmaker.SnapshotGame(gameID)
+        if !exists || gameState.IsFinished {
+                return
+        }
+
+        h.mu.RLock()
+        count := h.spectatorCount(gameID)
+        h.mu.RUnlock()
+
+        response := Message{Type: "spectators", Data: map[string]interface{}{"count": count}}
+        responseBytes, _ := json.Marshal(response)
+        h.sendToPlayers(gameID, responseBytes)
+}
@@ -1,6 +1,8 @@
 import { useState, useEffect } from 'react'
 import GameBoard from './components/GameBoard'
 import Leaderboard from './components/Leaderboard'
+import Chat from './components/Chat'
+import LiveGames from './components/LiveGames'
 import useWebSocket from './hooks/useWebSocket'
 
 function App() {
@@ -9,6 +11,11 @@ function App() {
   const [gameState, setGameState] = useState(null)
   const [error, setError] = useState('')
   const [leaderboard, setLeaderboard] = useState([])
+  const [liveGames, setLiveGames] = useState([])
+  const [chatMessages, setChatMessages] = useState([])
+  const [muted, setMuted] = useState([])
+  const [roomCode, setRoomCode] = useState('')
+  const [now, setNow] = useState(Date.now())
 
   const { sendMessage, lastMessage, connectionStatus } = useWebSocket()
 
@@ -20,10 +27,28 @@ function App() {
 
   useEffect(() => {
     fetchLeaderboard()
-    const interval = setInterval(fetchLeaderboard, 10000)
+    fetchLiveGames()
+    const interval = setInterval(() => {
+      fetchLeaderboard()
+      fetchLiveGames()
+    }, 10000)
     return () => clearInterval(interval)
   }, [])
 
+  useEffect(() => {
+    if (!gameState?.clocks || gameState.status !== 'playing') {
+      return
+    }
+    const interval = setInterval(() => setNow(Date.now()), 250)
+    return () => clearInterval(interval)
+  }, [gameState?.clocks, gameState?.status])
+
+  const timeLeft = (player) => {
+    const clock = gameState.clocks[`player${player}`]
+    const elapsed = player === gameState.currentTurn ? now - gameState.clocksAt : 0
+    return Math.max(0, Math.ceil((clock - elapsed) / 1000))
+  }
+
   const fetchLeaderboard = async () => {
     try {
       const response = await fetch('/api/leaderboard')
@@ -34,6 +59,16 @@ function App() {
     }
   }
 
+  const fetchLiveGames = async () => {
+    try {
+      const response = await fetch('/api/games/live')
+      const data = await response.json()
+      setLiveGames(data || [])
+    } catch (err) {
+      setLiveGames([])
+    }
+  }
+
   const handleMessage = (message) => {
     const msg = typeof message === 'string' ? JSON.parse(message) : message
 
@@ -42,59 +77,184 @@ function App() {
         setGameState({ status: 'waiting' })
         break
 
+      case 'room_created':
+        setGameState({ status: 'room', code: msg.data.code })
+        break
+
+      case 'room_expired':
+        setError('Your room expired before anyone joined')
+        setTimeout(() => setError(''), 5000)
+        setHasJoined(false)
+        setGameState(null)
+        break
+
       case 'game_start':
+        setChatMessages([])
+        if (msg.data.resumeToken) {
+          sessionStorage.setItem('resumeToken', msg.data.resumeToken)
+        }
         setGameState({
           status: 'playing',
           gameId: msg.data.gameId,
           player1: msg.data.player1,
           player2: msg.data.player2,
-          board: Array(6).fill(null).map(() => Array(7).fill(0)),
+          board: Array(msg.data.rules?.rows ?? 6).fill(null).map(() => Array(msg.data.rules?.cols ?? 7).fill(0)),
           currentTurn: 1,
           yourTurn: msg.data.yourTurn,
-          playerNumber: msg.data.yourTurn ? 1 : 2
+          playerNumber: msg.data.yourTurn ? 1 : 2,
+          rated: msg.data.rated,
+          hints: msg.data.hints,
+          series: msg.data.series,
+          clocks: msg.data.clocks,
+          clocksAt: Date.now()
         })
         break
 
       case 'move':
         if (gameState && gameState.board) {
           const newBoard = gameState.board.map(row => [...row])
-          newBoard[msg.data.row][msg.data.column] = msg.data.player
+          if (msg.data.kind === 'pop') {
+            for (let row = newBoard.length - 1; row > 0; row--) {
+              newBoard[row][msg.data.column] = newBoard[row - 1][msg.data.column]
+            }
+            newBoard[0][msg.data.column] = 0
+          } else {
+            newBoard[msg.data.row][msg.data.column] = msg.data.player
+          }
           
           setGameState({
             ...gameState,
             board: newBoard,
             currentTurn: msg.data.player === 1 ? 2 : 1,
-            yourTurn: gameState.playerNumber !== msg.data.player
+            yourTurn: gameState.playerNumber === (msg.data.player === 1 ? 2 : 1),
+            hint: null,
+            drawOffered: gameState.drawOffered && gameState.playerNumber !== msg.data.player,
+            clocks: msg.data.clocks,
+            clocksAt: Date.now()
           })
         }
         break
 
       case 'game_over':
+        sessionStorage.removeItem('resumeToken')
         if (gameState) {
           setGameState({
             ...gameState,
             status: 'finished',
             winner: msg.data.winner,
-            reason: msg.data.reason
+            winningLine: msg.data.winningLine || [],
+            reason: msg.data.reason,
+            series: msg.data.series || gameState.series
           })
           fetchLeaderboard()
         }
         break
 
+      case 'rematch_offered':
+        if (gameState) {
+          setGameState({ ...gameState, rematchOffered: true })
+        }
+        break
+
+      case 'rematch_declined':
+      case 'rematch_expired':
+        if (gameState) {
+          setGameState({ ...gameState, rematchOffered: false, rematchPending: false })
+        }
+        setError(msg.type === 'rematch_declined' ? 'Rematch declined' : 'Rematch offer expired')
+        setTimeout(() => setError(''), 5000)
+        break
+
+      case 'draw_offered':
+        if (gameState) {
+          setGameState({ ...gameState, drawOffered: true })
+        }
+        break
+
+      case 'draw_declined':
+        setError('Draw offer declined')
+        setTimeout(() => setError(''), 5000)
+        break
+
+      case 'hint':
+        if (gameState) {
+          setGameState({ ...gameState, hint: msg.data })
+        }
+        break
+
+      case 'spectate_start':
+        setChatMessages([])
+        setHasJoined(true)
+        setGameState({
+          status: 'playing',
+          spectating: true,
+          gameId: msg.data.gameId,
+          player1: msg.data.player1,
+          player2: msg.data.player2,
+          board: msg.data.board,
+          currentTurn: msg.data.currentTurn,
+          yourTurn: false,
+          playerNumber: 0,
+          rated: msg.data.rated,
+          clocks: msg.data.clocks,
+          clocksAt: Date.now(),
+          spectators: msg.data.spectators
+        })
+        break
+
+      case 'spectators':
+        if (gameState) {
+          setGameState({ ...gameState, spectators: msg.data.count })
+        }
+        break
+
+      case 'chat':
+      case 'reaction':
+        setChatMessages((messages) => [...messages, msg.data])
+        break
+
+      case 'muted':
+        setMuted((names) => [...names.filter((name) => name !== msg.data.username), msg.data.username])
+        break
+
+      case 'unmuted':
+        setMuted((names) => names.filter((name) => name !== msg.data.username))
+        break
+
+      case 'resume_failed':
+        sessionStorage.removeItem('resumeToken')
+        break
+
       case 'error':
+        if (!gameState) {
+          setHasJoined(false)
+        }
         setError(msg.error)
         setTimeout(() => setError(''), 5000)
         break
 
-      case 'reconnected':
-        if (msg.data.board) {
-          setGameState({
-            ...gameState,
-            board: msg.data.board,
-            currentTurn: msg.data.turn,
-            status: 'playing'
-          })
-        }
+      case 'game_state':
+        setHasJoined(true)
+        setUsername(msg.data.playerNumber === 1 ? msg.data.player1 : msg.data.player2)
+        setGameState({
+          status: msg.data.isFinished ? 'finished' : 'playing',
+          gameId: msg.data.gameId,
+          player1: msg.data.player1,
+          player2: msg.data.player2,
+          board: msg.data.board,
+          currentTurn: msg.data.currentTurn,
+          yourTurn: msg.data.yourTurn,
+          playerNumber: msg.data.playerNumber,
+          rated: msg.data.rated,
+          hints: msg.data.hints,
+          clocks: msg.data.clocks,
+          clocksAt: Date.now(),
+          drawOffered: msg.data.drawOffer && msg.data.drawOffer !== msg.data.playerNumber,
+          spectators: msg.data.spectators,
+          winner: msg.data.winner,
+          reason: msg.data.reason,
+          winningLine: msg.data.winningLine || []
+        })
         break
     }
   }
@@ -110,6 +270,52 @@ function App() {
     }
   }
 
+  const handleCreateRoom = () => {
+    if (username.trim()) {
+      sendMessage({
+        type: 'create_room',
+        username: username.trim()
+      })
+      setHasJoined(true)
+    }
+  }
+
+  const handleJoinRoom = () => {
+    if (username.trim() && roomCode.trim()) {
+      sendMessage({
+        type: 'join_room',
+        username: username.trim(),
+        code: roomCode.trim()
+      })
+      setHasJoined(true)
+    }
+  }
+
+  const handleWatch = (gameId) => {
+    sendMessage({ type: 'spectate', gameId })
+  }
+
+  const handleStopWatching = () => {
+    sendMessage({ type: 'stop_spectating' })
+    handleNewGame()
+  }
+
+  const handleChat = (text) => {
+    sendMessage({ type: 'chat', text })
+  }
+
+  const handleReaction = (reaction) => {
+    sendMessage({ type: 'reaction', reaction })
+  }
+
+  const handleMute = (name) => {
+    sendMessage({ type: 'mute', username: name })
+  }
+
+  const handleUnmute = (name) => {
+    sendMessage({ type: 'unmute', username: name })
+  }
+
   const handleMove = (column) => {
     if (gameState && gameState.yourTurn && gameState.status === 'playing') {
       sendMessage({
@@ -119,11 +325,28 @@ function App() {
     }
   }
 
+  const handleHint = () => {
+    sendMessage({ type: 'hint' })
+  }
+
+  const handleDraw = (type) => {
+    sendMessage({ type })
+    setGameState({ ...gameState, drawOffered: false })
+  }
+
+  const handleRematch = (type) => {
+    sendMessage({ type })
+    setGameState({ ...gameState, rematchOffered: false, rematchPending: type === 'rematch_offer' })
+  }
+
   const handleNewGame = () => {
+    sessionStorage.removeItem('resumeToken')
     setHasJoined(false)
     setGameState(null)
     setUsername('')
+    setRoomCode('')
     setError('')
+    setChatMessages([])
   }
 
   return (
@@ -149,6 +372,15 @@ function App() {
               required
             />
             <button type="submit">Join Game</button>
+            <button type="button" onClick={handleCreateRoom}>Create Private Room</button>
+            <input
+              type="text"
+              placeholder="Room code"
+              value={roomCode}
+              onChange={(e) => setRoomCode(e.target.value)}
+              maxLength={6}
+            />
+            <button type="button" onClick={handleJoinRoom}>Join Room</button>
           </form>
         ) : gameState ? (
           <>
@@ -158,32 +390,81 @@ function App() {
               </div>
             )}
 
+            {gameState.status === 'room' && (
+              <div className="waiting-message">
+                Share the code <strong>{gameState.code}</strong> with a friend to start playing
+              </div>
+            )}
+
             {gameState.status === 'playing' && (
               <>
                 <div className="player-info">
                   <div className={`player ${gameState.currentTurn === 1 ? 'active' : ''}`}>
                     <strong>🔴 {gameState.player1}</strong>
                     {gameState.playerNumber === 1 && ' (You)'}
+                    {gameState.clocks && ` ${timeLeft(1)}s`}
                   </div>
                   <div className={`player ${gameState.currentTurn === 2 ? 'active' : ''}`}>
                     <strong>🟡 {gameState.player2}</strong>
                     {gameState.playerNumber === 2 && ' (You)'}
+                    {gameState.clocks && ` ${timeLeft(2)}s`}
                   </div>
                 </div>
 
+                {gameState.series && (
+                  <p className="series-score">
+                    Series: {gameState.player1} {gameState.series.wins[gameState.player1] || 0}
+                    {' - '}
+                    {gameState.series.wins[gameState.player2] || 0} {gameState.player2}
+                  </p>
+                )}
+
+                {gameState.spectators > 0 && (
+                  <p className="series-score">👀 {gameState.spectators} watching</p>
+                )}
+
                 <GameBoard
                   board={gameState.board}
                   onMove={handleMove}
                   disabled={!gameState.yourTurn}
                 />
 
+                {gameState.spectating ? (
+                  <div className="game-info">
+                    <p>You are watching this game</p>
+                    <button className="hint-btn" onClick={handleStopWatching}>Stop Watching</button>
+                  </div>
+                ) : (
                 <div className="game-info">
                   {gameState.yourTurn ? (
                     <p><strong>Your turn!</strong> Click a column to drop your disc.</p>
                   ) : (
                     <p>Waiting for opponent's move...</p>
                   )}
+                  {gameState.yourTurn && gameState.hints && (
+                    <button className="hint-btn" onClick={handleHint}>Hint</button>
+                  )}
+                  {gameState.drawOffered ? (
+                    <p>
+                      Your opponent offers a draw{' '}
+                      <button className="hint-btn" onClick={() => handleDraw('accept_draw')}>Accept</button>
+                      <button className="hint-btn" onClick={() => handleDraw('decline_draw')}>Decline</button>
+                    </p>
+                  ) : (
+                    <p>
+                      <button className="hint-btn" onClick={() => handleDraw('offer_draw')}>Offer Draw</button>
+                      <button className="hint-btn" onClick={() => sendMessage({ type: 'resign' })}>Resign</button>
+                    </p>
+                  )}
+                  {gameState.hint && (
+                    <p>
+                      💡 Try column {gameState.hint.bestColumn + 1}
+                      {gameState.hint.forcedWin && ` (wins in ${gameState.hint.movesToWin})`}
+                      {gameState.hint.forcedLoss && ' (every move loses)'}
+                    </p>
+                  )}
                 </div>
+                )}
               </>
             )}
 
@@ -193,6 +474,7 @@ function App() {
                   board={gameState.board}
                   onMove={() => {}}
                   disabled={true}
+                  winningLine={gameState.winningLine}
                 />
                 
                 <div className="winner-message">
@@ -203,21 +485,50 @@ function App() {
                     : `${gameState.winner} won!`}
                 </div>
 
-                {gameState.reason === 'opponent_disconnected' && (
-                  <p>Opponent disconnected</p>
+                {gameState.reason === 'disconnect' && <p>{gameState.spectating ? 'A player disconnected' : 'Opponent disconnected'}</p>}
+                {gameState.reason === 'resignation' && <p>By resignation</p>}
+                {gameState.reason === 'agreement' && <p>Draw agreed</p>}
+                {gameState.reason === 'timeout' && <p>On time</p>}
+                {gameState.reason === 'illegal_move' && <p>The bot made an illegal move</p>}
+
+                {gameState.spectating ? null : gameState.rematchOffered ? (
+                  <div className="rematch">
+                    <p>Your opponent wants a rematch</p>
+                    <button className="new-game-btn" onClick={() => handleRematch('rematch_accept')}>Accept</button>
+                    <button className="new-game-btn" onClick={() => handleRematch('rematch_decline')}>Decline</button>
+                  </div>
+                ) : gameState.rematchPending ? (
+                  <p>Waiting for your opponent to accept the rematch...</p>
+                ) : (
+                  <button className="new-game-btn" onClick={() => handleRematch('rematch_offer')}>
+                    Rematch
+                  </button>
                 )}
 
                 <button className="new-game-btn" onClick={handleNewGame}>
-                  Play Again
+                  {gameState.spectating ? 'Back' : 'Play Again'}
                 </button>
               </>
             )}
+
+            {(gameState.status === 'playing' || gameState.status === 'finished') && (
+              <Chat
+                messages={chatMessages.filter((message) => message.from === username || !muted.includes(message.from))}
+                self={username}
+                muted={muted}
+                onSend={handleChat}
+                onReact={handleReaction}
+                onMute={handleMute}
+                onUnmute={handleUnmute}
+              />
+            )}
           </>
         ) : (
           <div className="waiting-message">Joining game...</div>
         )}
       </div>
 
+      {!hasJoined && <LiveGames games={liveGames} onWatch={handleWatch} />}
       <Leaderboard leaderboard={leaderboard} />
     </div>
   )
@@ -0,0 +1,61 @@
+import { useState } from 'react'
+
+const REACTIONS = ['👍', '👏', '😮', '😂', '😢', '🔥']
+
+function Chat({ messages, self, muted, onSend, onReact, onMute, onUnmute }) {
+  const [text, setText] = useState('')
+
+  const handleSubmit = (e) => {
+    e.preventDefault()
+    if (text.trim()) {
+      onSend(text.trim())
+      setText('')
+    }
+  }
+
+  return (
+    <div className="chat">
+      <ul className="chat-messages">
+        {messages.map((message, index) => (
+          <li key={index}>
+            <strong>{message.from}</strong>
+            {message.spectator && ' (watching)'}
+            {': '}
+            {message.reaction || message.text}
+            {message.from !== self && (
+              <>
+                {' '}
+                <button className="mute-btn" onClick={() => onMute(message.from)}>mute</button>
+              </>
+            )}
+          </li>
+        ))}
+      </ul>
+      <div className="chat-reactions">
+        {REACTIONS.map((reaction) => (
+          <button key={reaction} className="mute-btn" onClick={() => onReact(reaction)}>{reaction}</button>
+        ))}
+      </div>
+      <form className="chat-form" onSubmit={handleSubmit}>
+        <input
+          type="text"
+          placeholder="Say something"
+          value={text}
+          onChange={(e) => setText(e.target.value)}
+          maxLength={200}
+        />
+        <button type="submit" className="hint-btn">Send</button>
+      </form>
+      {muted.length > 0 && (
+        <p className="chat-muted">
+          Muted:{' '}
+          {muted.map((name) => (
+            <button key={name} className="mute-btn" onClick={() => onUnmute(name)}>{name} ✕</button>
+          ))}
+        </p>
+      )}
+    </div>
+  )
+}
+
+export default Chat
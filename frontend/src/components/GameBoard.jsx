@@ -1,10 +1,13 @@
-function GameBoard({ board, onMove, disabled }) {
+function GameBoard({ board, onMove, disabled, winningLine = [] }) {
   const handleColumnClick = (col) => {
     if (!disabled) {
       onMove(col)
     }
   }
 
+  const isWinning = (row, col) =>
+    winningLine.some(cell => cell.row === row && cell.column === col)
+
   return (
     <div className="board">
       {board.map((row, rowIndex) => (
@@ -14,7 +17,7 @@ function GameBoard({ board, onMove, disabled }) {
               key={`${rowIndex}-${colIndex}`}
               className={`cell ${
                 cell === 1 ? 'player1' : cell === 2 ? 'player2' : ''
-              } ${disabled ? 'disabled' : ''}`}
+              } ${disabled ? 'disabled' : ''} ${isWinning(rowIndex, colIndex) ? 'winning' : ''}`}
               onClick={() => !disabled && rowIndex === 0 && handleColumnClick(colIndex)}
             />
           ))}
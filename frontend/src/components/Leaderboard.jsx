@@ -16,6 +16,7 @@ function Leaderboard({ leaderboard }) {
                 <strong>{player.username}</strong>
               </div>
               <div className="stats">
+                <span>Rating: {Math.round(player.rating || 1500)}</span>
                 <span>Wins: {player.wins || 0}</span>
                 <span>Games: {totalGames}</span>
               </div>
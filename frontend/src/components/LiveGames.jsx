@@ -0,0 +1,27 @@
+function LiveGames({ games, onWatch }) {
+  if (!games || games.length === 0) {
+    return null
+  }
+
+  return (
+    <div className="leaderboard">
+      <h2>👀 Live Games</h2>
+      <ul className="leaderboard-list">
+        {games.map((game) => (
+          <li key={game.id} className="leaderboard-item">
+            <div>
+              <strong>{game.player1}</strong> vs <strong>{game.player2}</strong>
+            </div>
+            <div className="stats">
+              <span>Moves: {game.moves}</span>
+              <span>Watching: {game.spectators}</span>
+              <button className="hint-btn" onClick={() => onWatch(game.id)}>Watch</button>
+            </div>
+          </li>
+        ))}
+      </ul>
+    </div>
+  )
+}
+
+export default LiveGames
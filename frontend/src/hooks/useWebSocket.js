@@ -14,6 +14,10 @@ const useWebSocket = () => {
 
     ws.current.onopen = () => {
       setConnectionStatus('connected')
+      const resumeToken = sessionStorage.getItem('resumeToken')
+      if (resumeToken) {
+        ws.current.send(JSON.stringify({ type: 'resume', token: resumeToken }))
+      }
     }
 
     ws.current.onmessage = (event) => {